@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/money"
+	"diplom_ya/internal/store"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const ledgerUsage = "usage: gophermart [flags] ledger reconcile | adjust <userID> <amount> [comment] | reverse <entryID> [comment]"
+
+// runLedger выполняет подкоманду ledger: сверку и ручные проводки.
+func runLedger(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(ledgerUsage)
+	}
+
+	storage, err := store.New(cfg)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "reconcile":
+		result, err := storage.Reconcile(ctx)
+		if err != nil {
+			return err
+		}
+		for _, drift := range result.Drifts {
+			fmt.Printf("drift: user %s balance %s, ledger %s\n", drift.UserID, drift.Cached, drift.Ledger)
+		}
+		for _, entryID := range result.Unbalanced {
+			fmt.Printf("unbalanced entry %s\n", entryID)
+		}
+		if !result.OK() {
+			return errors.New("ledger: reconciliation failed")
+		}
+		fmt.Println("ledger is consistent")
+	case "adjust":
+		if len(args) < 3 {
+			return errors.New(ledgerUsage)
+		}
+		amount, err := money.Parse(args[2])
+		if err != nil {
+			return err
+		}
+		entryID, err := storage.PostAdjustment(ctx, args[1], amount, strings.Join(args[3:], " "))
+		if err != nil {
+			return err
+		}
+		fmt.Println(entryID)
+	case "reverse":
+		if len(args) < 2 {
+			return errors.New(ledgerUsage)
+		}
+		entryID, err := storage.ReverseEntry(ctx, args[1], strings.Join(args[2:], " "))
+		if err != nil {
+			return err
+		}
+		fmt.Println(entryID)
+	default:
+		return errors.New(ledgerUsage)
+	}
+
+	return nil
+}
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
 	"diplom_ya/internal/config"
 	"diplom_ya/internal/handlers"
+	"diplom_ya/internal/notify"
+	"diplom_ya/internal/password"
 	"diplom_ya/internal/store"
 	"diplom_ya/internal/workers"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os/signal"
+	"syscall"
+	_ "time/tzdata" // DISPLAY_TIMEZONE без системной базы часовых поясов
 
 	"github.com/go-chi/chi/v5"
 )
@@ -25,23 +33,100 @@ func main() {
 	// config
 	cfg := config.New()
 
+	// gophermart [flags] migrate | ledger | user ...
+	if args := flag.Args(); len(args) > 0 {
+		var err error
+		switch args[0] {
+		case "migrate":
+			err = runMigrate(cfg, args[1:])
+		case "ledger":
+			err = runLedger(cfg, args[1:])
+		case "user":
+			err = runUser(cfg, args[1:])
+		default:
+			err = fmt.Errorf("unknown command %q", args[0])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if _, err := password.New(cfg); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := notify.New(cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	// остановка по SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	// data base
-	if err := store.DBInit(&cfg); err != nil {
+	storage, err := store.New(cfg)
+	if err != nil {
 		log.Fatal(err)
 	}
-	defer cfg.ConnectDB.Close()
 
 	// router
-	router := handlers.NewRouter(cfg)
+	router := handlers.NewRouter(cfg, storage)
 
 	// server
 	server := createServer(cfg, router)
 
 	// workers
-	workers.StartWorkers(cfg)
-	defer workers.CloseWorkers(cfg)
+	ctxWorkers, stopWorkers := context.WithCancel(context.Background())
+	pool := workers.StartWorkers(ctxWorkers, cfg, storage)
+	log.Printf("started %d accrual pollers", pool.Size())
 
 	// listen
-	log.Fatal(server.ListenAndServe())
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	var runErr error
+	select {
+	case runErr = <-serverErr:
+	case <-ctx.Done():
+		log.Println("shutting down")
+	}
+	stop()
 
+	if err := shutdown(cfg, server, stopWorkers, pool, storage); err != nil {
+		log.Println(err)
+	}
+	if runErr != nil {
+		log.Fatal(runErr)
+	}
+}
+
+// shutdown останавливает сервис в пределах cfg.ShutdownTimeout: перестаёт
+// принимать запросы и дожидается начатых, останавливает обработку заказов,
+// дожидаясь записи уже полученных результатов, и закрывает базу данных.
+func shutdown(cfg config.Config, server *http.Server, stopWorkers context.CancelFunc, pool *workers.Pool, storage store.Storage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+
+	if err := server.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("http server: %w", err))
+	}
+
+	stopWorkers()
+	if err := pool.Shutdown(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := storage.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("storage: %w", err))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("shutdown: %v", errs)
+	}
+	log.Println("stopped")
+	return nil
 }
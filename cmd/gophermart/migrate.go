@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/store"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+const migrateUsage = "usage: gophermart [flags] migrate up | down [steps] | to <version> | status"
+
+// runMigrate выполняет подкоманду migrate.
+func runMigrate(cfg config.Config, args []string) error {
+	if cfg.DataBase == "" {
+		return errors.New("migrate: database address is not set (-d or DATABASE_URI)")
+	}
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := store.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := store.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		err = migrator.Down(ctx, steps)
+	case "to":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		target, convErr := strconv.Atoi(args[1])
+		if convErr != nil || target < 0 {
+			return errors.New(migrateUsage)
+		}
+		err = migrator.To(ctx, target)
+	case "status":
+	default:
+		return errors.New(migrateUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d (latest %d)\n", version, migrator.Latest())
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"diplom_ya/internal/auth"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/store"
+	"diplom_ya/internal/validation"
+	"errors"
+	"fmt"
+)
+
+const userUsage = "usage: gophermart [flags] user grant <login> <role> | revoke <login> <role> | unlock <login> [ip] | disable-totp <login>"
+
+// runUser выполняет подкоманду user: роли, блокировки входа и второй фактор.
+func runUser(cfg config.Config, args []string) error {
+	if len(args) < 2 {
+		return errors.New(userUsage)
+	}
+
+	storage, err := store.New(cfg)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	ctx := context.Background()
+	login := validation.NormalizeLogin(args[1])
+
+	switch args[0] {
+	case "grant", "revoke":
+		if len(args) != 3 {
+			return errors.New(userUsage)
+		}
+		userID, _, err := storage.ReadUser(ctx, login)
+		if err != nil {
+			return err
+		}
+		if userID == "" {
+			return fmt.Errorf("user %q not found", login)
+		}
+		if args[0] == "grant" {
+			err = storage.GrantRole(ctx, userID, args[2])
+		} else {
+			err = storage.RevokeRole(ctx, userID, args[2])
+		}
+		if err != nil {
+			return err
+		}
+	case "unlock":
+		ip := ""
+		if len(args) > 2 {
+			ip = args[2]
+		}
+		if err := auth.UnlockLogin(ctx, storage, login, ip); err != nil {
+			return err
+		}
+	case "disable-totp":
+		// пользователь потерял и телефон, и коды восстановления
+		userID, _, err := storage.ReadUser(ctx, login)
+		if err != nil {
+			return err
+		}
+		if userID == "" {
+			return fmt.Errorf("user %q not found", login)
+		}
+		if err := storage.DeleteTOTP(ctx, userID); err != nil {
+			return err
+		}
+	default:
+		return errors.New(userUsage)
+	}
+
+	fmt.Println("ok")
+	return nil
+}
@@ -0,0 +1,90 @@
+package accrual
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// probeInterval — как часто ждущие вызовы проверяют исход пробного запроса.
+const probeInterval = 100 * time.Millisecond
+
+// breaker — circuit breaker. После threshold ошибок подряд он размыкается
+// на cooldown: вызовы ждут, не обращаясь к системе расчёта. Затем проходит
+// один пробный запрос; успех замыкает цепь, ошибка размыкает снова.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow возвращает 0, если запрос можно выполнять, иначе — сколько ждать.
+func (b *breaker) allow() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.failures < b.threshold:
+		return 0
+	case time.Now().Before(b.openUntil):
+		return time.Until(b.openUntil)
+	case b.probing:
+		return probeInterval
+	default:
+		b.probing = true
+		return 0
+	}
+}
+
+func (b *breaker) wait(ctx context.Context) error {
+	for {
+		d := b.allow()
+		if d <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures >= b.threshold {
+		logf("service is back, resuming requests")
+	}
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+		logf("service unavailable, pausing requests for %s", b.cooldown)
+	}
+}
+
+// release снимает отметку пробного запроса, не меняя состояния.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
@@ -0,0 +1,212 @@
+// Package accrual — клиент системы расчёта начислений баллов лояльности.
+//
+// Клиент повторяет запросы при сетевых ошибках и ответах 5xx с
+// экспоненциальной задержкой и джиттером, соблюдает Retry-After из ответов
+// 429 общим для всех вызовов окном ожидания и приостанавливает запросы
+// (circuit breaker), когда система расчёта недоступна.
+package accrual
+
+import (
+	"context"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/money"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// defaultRetryAfter — пауза после 429 без корректного Retry-After.
+const defaultRetryAfter = 5 * time.Second
+
+var (
+	// ErrNotRegistered — заказ не зарегистрирован в системе расчёта (204).
+	ErrNotRegistered = errors.New("accrual: order is not registered")
+	// ErrTooManyRequests — лимит запросов не отпустил после всех попыток.
+	ErrTooManyRequests = errors.New("accrual: too many requests")
+)
+
+// Order — ответ GET /api/orders/{number}.
+type Order struct {
+	Order   string       `json:"order"`
+	Status  string       `json:"status"`
+	Accrual money.Amount `json:"accrual"`
+}
+
+type Client struct {
+	address    string
+	http       *http.Client
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+
+	limiter *limiter
+	breaker *breaker
+}
+
+// New создаёт клиента. Если httpClient не задан, используется клиент
+// с таймаутом cfg.AccrualTimeout.
+func New(cfg config.Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: cfg.AccrualTimeout}
+	}
+	return &Client{
+		address:    cfg.AccrualAddress,
+		http:       httpClient,
+		maxRetries: cfg.AccrualRetries,
+		baseDelay:  100 * time.Millisecond,
+		maxDelay:   10 * time.Second,
+		limiter:    &limiter{},
+		breaker:    newBreaker(cfg.AccrualBreakerThreshold, cfg.AccrualBreakerCooldown),
+	}
+}
+
+// GetOrder запрашивает расчёт начислений по заказу.
+func (c *Client) GetOrder(ctx context.Context, number string) (Order, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.wait(ctx); err != nil {
+			return Order{}, err
+		}
+		if err := c.breaker.wait(ctx); err != nil {
+			return Order{}, err
+		}
+
+		order, retryAfter, err := c.getOrder(ctx, number)
+
+		var transient *transientError
+		switch {
+		case err == nil, errors.Is(err, ErrNotRegistered):
+			c.breaker.success()
+			return order, err
+		case retryAfter > 0:
+			// 429 — система жива, просто просит подождать
+			c.breaker.success()
+			c.limiter.pause(retryAfter)
+			if attempt >= c.maxRetries {
+				return order, ErrTooManyRequests
+			}
+		case errors.As(err, &transient):
+			if ctx.Err() != nil {
+				// запрос отменён вызывающим, система расчёта ни при чём
+				c.breaker.release()
+				return order, ctx.Err()
+			}
+			c.breaker.failure()
+			if attempt >= c.maxRetries {
+				return order, err
+			}
+			if err := sleep(ctx, c.backoff(attempt)); err != nil {
+				return order, err
+			}
+		default:
+			c.breaker.success()
+			return order, err
+		}
+	}
+}
+
+func (c *Client) getOrder(ctx context.Context, number string) (Order, time.Duration, error) {
+	var order Order
+
+	address := c.address + "/api/orders/" + url.PathEscape(number)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return order, 0, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return order, 0, &transientError{err}
+	}
+	defer resp.Body.Close()
+	// дочитываем тело, чтобы соединение вернулось в пул
+	defer io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusNoContent:
+		return order, 0, ErrNotRegistered
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return order, parseRetryAfter(resp.Header.Get("Retry-After")), ErrTooManyRequests
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return order, 0, &transientError{fmt.Errorf("accrual: status %d", resp.StatusCode)}
+	default:
+		return order, 0, fmt.Errorf("accrual: unexpected status %d", resp.StatusCode)
+	}
+
+	// начисление округляется до сотых: система начислений — доверенный
+	// источник, и заказ не должен застрять из-за лишнего знака
+	var raw struct {
+		Order   string      `json:"order"`
+		Status  string      `json:"status"`
+		Accrual json.Number `json:"accrual"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&raw); err != nil {
+		return order, 0, fmt.Errorf("accrual: decode order %s: %w", number, err)
+	}
+	order.Order, order.Status = raw.Order, raw.Status
+	if raw.Accrual != "" {
+		if order.Accrual, err = money.ParseRounded(raw.Accrual.String()); err != nil {
+			return order, 0, fmt.Errorf("accrual: decode order %s: %w", number, err)
+		}
+	}
+	if order.Order == "" {
+		return order, 0, fmt.Errorf("accrual: empty order in response for %s", number)
+	}
+
+	return order, 0, nil
+}
+
+// backoff — экспоненциальная задержка с джиттером: случайное значение
+// из [d/2, d), где d = baseDelay * 2^attempt, но не больше maxDelay.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.maxDelay
+	if attempt < 30 && c.baseDelay<<attempt < c.maxDelay {
+		d = c.baseDelay << attempt
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter разбирает Retry-After в секундах или в виде HTTP-даты.
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d
+		}
+	}
+	return defaultRetryAfter
+}
+
+// transientError — ошибка, после которой запрос имеет смысл повторить.
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+func (e *transientError) Unwrap() error { return e.err }
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func logf(format string, args ...interface{}) {
+	log.Printf("accrual: "+format, args...)
+}
@@ -0,0 +1,43 @@
+package accrual
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter — общее окно ожидания после 429: пока оно не закончилось,
+// ни один вызов клиента не обращается к системе расчёта.
+type limiter struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func (l *limiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(l.until) {
+		l.until = until
+		logf("rate limited, pausing requests for %s", d)
+	}
+}
+
+// pausedUntil — момент окончания текущего окна ожидания.
+func (l *limiter) pausedUntil() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.until
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	for {
+		d := time.Until(l.pausedUntil())
+		if d <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, d); err != nil {
+			return err
+		}
+	}
+}
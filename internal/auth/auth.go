@@ -2,56 +2,104 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"diplom_ya/internal/config"
 	"diplom_ya/internal/cookie"
 	"diplom_ya/internal/encryption"
+	"diplom_ya/internal/password"
+	"diplom_ya/internal/problem"
 	"diplom_ya/internal/store"
+	"diplom_ya/internal/validation"
+	"errors"
+	"log"
 	"net/http"
+	"time"
 )
 
-func CheckAuthorized(cfg config.Config) func(http.Handler) http.Handler {
+// CheckAuthorized пропускает запрос только с действующим и не отозванным
+// access-токеном в заголовке Authorization: Bearer или, без заголовка,
+// с действующей сессией в cookie, и кладёт пользователя и его роли из
+// хранилища в контекст запроса (см. UserFromContext, RolesFromContext).
+func CheckAuthorized(cfg config.Config, storage store.Storage) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-			// получим куки для идентификации пользователя
-			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			if header := r.Header.Get("Authorization"); header != "" {
+				raw, ok := bearerToken(header)
+				if !ok {
+					problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "unsupported authorization scheme")
+					return
+				}
+				claims, err := parseAccessToken(cfg, raw)
+				if err != nil {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "invalid or expired access token")
+					return
+				}
+
+				// токен отозван выходом или сменой пароля
+				generation, err := storage.GetTokenGeneration(r.Context(), claims.Subject)
+				if err != nil {
+					problem.Internal(w, r, err)
+					return
+				}
+				if claims.Generation != generation {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidToken, "access token revoked")
+					return
+				}
 
-			userID := cookie.GetCookie(r, cfg, "userID")
-			if userID == "" {
+				// роли из токена устаревают до его истечения
+				roles, err := Roles(r.Context(), storage, claims.Subject)
+				if err != nil {
+					problem.Internal(w, r, err)
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(withUser(r.Context(), claims.Subject, roles)))
+				return
+			}
+
+			// получим куки для идентификации пользователя
+			sessionID := cookie.GetCookie(r, cfg, sessionCookie)
+			if sessionID == "" {
 				// no cookie
-				http.Error(w, "CheckAuth/ userID no cookie", http.StatusUnauthorized)
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "no session cookie")
 				return
 			}
 
-			exist, err := store.ExistsUserID(r.Context(), cfg, userID)
+			session, err := storage.GetSession(r.Context(), sessionID)
 			if err != nil {
 				// error server
-				http.Error(w, "CheckAuth/ data base err", http.StatusInternalServerError)
+				problem.Internal(w, r, err)
 				return
 			}
-			if !exist {
-				// no in data base
-				http.Error(w, "CheckAuth/ user not authorized", http.StatusUnauthorized)
+			if !session.Active(time.Now()) {
+				// нет, отозвана или истекла
+				problem.Write(w, r, http.StatusUnauthorized, problem.CodeUnauthorized, "session expired or revoked")
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			roles, err := Roles(r.Context(), storage, session.UserID)
+			if err != nil {
+				problem.Internal(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(withSession(r.Context(), session, roles)))
 		})
 	}
 }
 
-func LoginUse(ctx context.Context, cfg config.Config, login string) (bool, error) {
-	use, err := store.LoginUse(ctx, cfg, login)
-	return use, err
-}
-
-func NewUser(ctx context.Context, cfg config.Config, login string, pass string) (string, error) {
+func NewUser(ctx context.Context, cfg config.Config, storage store.Storage, login string, pass string) (string, error) {
 	// create hash
-	msg := login + pass
-	hash := encryption.Encrypt(msg, cfg)
+	hash, err := hashPassword(cfg, pass)
+	if err != nil {
+		return "", err
+	}
 
 	// write in db login/hash
-	userID, err := store.WriteNewUser(ctx, cfg, login, hash)
+	userID, err := storage.WriteNewUser(ctx, login, hash)
 	if err != nil {
 		return "", err
 	}
@@ -59,16 +107,110 @@ func NewUser(ctx context.Context, cfg config.Config, login string, pass string)
 	return userID, nil
 }
 
-func AuthorizeUser(ctx context.Context, cfg config.Config, login string, pass string) (string, error) {
-	// create hash
-	msg := login + pass
-	hash := encryption.Encrypt(msg, cfg)
+// AuthorizeUser проверяет пару логин/пароль и возвращает userID или "",
+// если пара неверна. Логин ищется без учёта регистра. Хеши старого формата
+// (HMAC от логина в том виде, как его вводят, и пароля) и хеши с устаревшими
+// параметрами пересчитываются текущим алгоритмом при входе.
+//
+// Если у пользователя включён второй фактор, нужен ещё code — код из
+// приложения или код восстановления; без него ошибка ErrTOTPRequired,
+// с неверным — ErrTOTPInvalid.
+//
+// Попытка учитывается защитой от перебора по логину и адресу ip (см.
+// beginAttempt): пока вход закрыт — *LockedError без проверки пароля.
+func AuthorizeUser(ctx context.Context, cfg config.Config, storage store.Storage, login string, pass string, code string, ip string) (string, error) {
+	guard, err := beginAttempt(ctx, cfg, storage, validation.NormalizeLogin(login), ip)
+	if err != nil {
+		return "", err
+	}
 
-	// read in db login/hash
-	userID, err := store.ReadUser(ctx, cfg, login, hash)
+	userID, err := authorizeUser(ctx, cfg, storage, login, pass, code)
+	switch {
+	case err == nil && userID != "":
+		err = guard.succeeded(ctx)
+	case err == nil, errors.Is(err, ErrTOTPInvalid):
+		// неудача уже засчитана
+		return "", err
+	default:
+		// пароль верен, но нужен код, или ошибка хранилища — не неудача
+		if releaseErr := guard.release(ctx); releaseErr != nil {
+			return "", releaseErr
+		}
+	}
 	if err != nil {
 		return "", err
 	}
+	return userID, nil
+}
+
+func authorizeUser(ctx context.Context, cfg config.Config, storage store.Storage, login string, pass string, code string) (string, error) {
+	// read in db login/hash
+	userID, hash, err := storage.ReadUser(ctx, validation.NormalizeLogin(login))
+	if err != nil || userID == "" {
+		return "", err
+	}
+
+	ok, err := checkPassword(ctx, cfg, storage, userID, login, pass, hash)
+	if err != nil || !ok {
+		return "", err
+	}
+
+	if err := secondFactor(ctx, cfg, storage, userID, code); err != nil {
+		return "", err
+	}
+
 	// return userID
 	return userID, nil
 }
+
+// checkPassword сверяет пароль с хешем пользователя и при успехе
+// пересчитывает устаревший хеш.
+func checkPassword(ctx context.Context, cfg config.Config, storage store.Storage, userID string, login string, pass string, hash string) (bool, error) {
+	hasher, err := password.New(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	var ok bool
+	if password.Known(hash) {
+		ok, err = password.Verify(pass, hash)
+		if err != nil {
+			return false, err
+		}
+	} else {
+		ok = verifyLegacy(cfg, login, pass, hash)
+	}
+	if !ok {
+		return false, nil
+	}
+
+	if !hasher.Current(hash) {
+		rehash(ctx, hasher, storage, userID, pass)
+	}
+	return true, nil
+}
+
+// verifyLegacy проверяет хеш, записанный до перехода на password:
+// hex(HMAC-SHA256(ключ, login+pass)) любым ключом набора cfg.MACKeys.
+func verifyLegacy(cfg config.Config, login string, pass string, hash string) bool {
+	ok := false
+	for _, key := range cfg.MACKeys.Keys() {
+		legacy := encryption.Encrypt(login+pass, key)
+		if subtle.ConstantTimeCompare([]byte(legacy), []byte(hash)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// rehash пересчитывает хеш пароля; ошибка не мешает входу — хеш
+// обновится при следующем.
+func rehash(ctx context.Context, hasher password.Hasher, storage store.Storage, userID string, pass string) {
+	hash, err := hasher.Hash(pass)
+	if err == nil {
+		err = storage.UpdatePasswordHash(ctx, userID, hash)
+	}
+	if err != nil {
+		log.Printf("auth: rehash password of %s: %v", userID, err)
+	}
+}
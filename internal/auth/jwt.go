@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/store"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// RoleUser — роль, которая есть у каждого пользователя.
+const RoleUser = "user"
+
+var (
+	ErrJWTDisabled  = errors.New("auth: JWT keys are not configured")
+	errInvalidToken = errors.New("auth: invalid token")
+)
+
+// Claims — утверждения access-токена: sub — userID, roles — роли на
+// момент выдачи (для клиента; сервер берёт роли из хранилища), gen —
+// поколение токенов пользователя, см. RevokeAccessTokens.
+type Claims struct {
+	Roles      []string `json:"roles"`
+	Generation int64    `json:"gen"`
+	jwt.RegisteredClaims
+}
+
+// Roles возвращает роли пользователя, включая RoleUser.
+func Roles(ctx context.Context, storage store.Storage, userID string) ([]string, error) {
+	roles, err := storage.GetRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{RoleUser}, roles...), nil
+}
+
+// IssueAccessToken подписывает активным ключом cfg.JWTKeys токен
+// пользователя на cfg.JWTTTL.
+func IssueAccessToken(ctx context.Context, cfg config.Config, storage store.Storage, userID string) (string, time.Time, error) {
+	if cfg.JWTKeys == nil {
+		return "", time.Time{}, ErrJWTDisabled
+	}
+
+	roles, err := Roles(ctx, storage, userID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	generation, err := storage.GetTokenGeneration(ctx, userID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expires := now.Add(cfg.JWTTTL)
+	claims := Claims{
+		Roles:      roles,
+		Generation: generation,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    cfg.JWTIssuer,
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{cfg.JWTAudience},
+			ExpiresAt: jwt.NewNumericDate(expires),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	key := cfg.JWTKeys.Signing()
+	signKey, err := key.SignKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Alg), claims)
+	token.Header["kid"] = key.ID
+
+	signed, err := token.SignedString(signKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expires, nil
+}
+
+// parseAccessToken проверяет подпись ключом из набора по kid, алгоритм
+// ключа, exp/nbf/iat, iss и aud.
+func parseAccessToken(cfg config.Config, raw string) (Claims, error) {
+	var claims Claims
+
+	if cfg.JWTKeys == nil {
+		return claims, ErrJWTDisabled
+	}
+
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg()}))
+	_, err := parser.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := cfg.JWTKeys.Lookup(kid)
+		// алгоритм задаёт ключ, а не заголовок токена
+		if !ok || token.Method.Alg() != key.Alg {
+			return nil, errInvalidToken
+		}
+		return key.VerifyKey(), nil
+	})
+	if err != nil {
+		return claims, err
+	}
+
+	switch {
+	case claims.ExpiresAt == nil, claims.Subject == "":
+		return claims, errInvalidToken
+	case !claims.VerifyIssuer(cfg.JWTIssuer, true):
+		return claims, errInvalidToken
+	case !claims.VerifyAudience(cfg.JWTAudience, true):
+		return claims, errInvalidToken
+	}
+
+	return claims, nil
+}
+
+// RevokeAccessTokens отзывает все выданные пользователю access-токены:
+// токен действует, пока его gen совпадает с поколением в хранилище.
+// Клиенты с живым refresh-токеном получат новый access-токен обменом.
+func RevokeAccessTokens(ctx context.Context, storage store.Storage, userID string) error {
+	return storage.BumpTokenGeneration(ctx, userID)
+}
+
+// bearerToken достаёт токен из заголовка "Authorization: Bearer <token>".
+func bearerToken(header string) (string, bool) {
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/problem"
+	"diplom_ya/internal/store"
+	"diplom_ya/internal/validation"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// RoleAdmin — роль администратора.
+const RoleAdmin = "admin"
+
+// предел прогрессивной задержки до полной блокировки
+const maxLoginDelay = time.Minute
+
+// LockedError — проверка пароля или кода закрыта защитой от перебора.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("auth: too many failed attempts, retry after %s", e.RetryAfter)
+}
+
+// attempt — попытка проверить пароль или код пользователя, заранее
+// засчитанная неудачей по логину и по IP. Неверный секрет ничего больше
+// не делает; верный — succeeded, не неудача вовсе — release.
+type attempt struct {
+	cfg     config.Config
+	storage store.Storage
+	scopes  []loginScope
+}
+
+// beginAttempt засчитывает попытку до проверки секрета, поэтому
+// параллельные попытки не проскакивают задержку и блокировку: по логину —
+// прогрессивная задержка, затем cfg.LoginLockout; по IP — cfg.LoginLockout
+// после cfg.LoginIPMaxFailures неудач. Пока вход закрыт — *LockedError,
+// и секрет не проверяется.
+func beginAttempt(ctx context.Context, cfg config.Config, storage store.Storage, login string, ip string) (*attempt, error) {
+	now := time.Now()
+	since := now.Add(-cfg.LoginFailureWindow)
+	a := &attempt{cfg: cfg, storage: storage}
+
+	for _, item := range loginScopes(login, ip) {
+		until, err := storage.ReserveLoginAttempt(ctx, item.scope, item.key, now, since, a.lockFor(item.scope))
+		if err == nil && until.IsZero() {
+			a.scopes = append(a.scopes, item)
+			continue
+		}
+
+		// вход закрыт по одной из областей: засчитанное в других возвращается
+		if releaseErr := a.release(ctx); err == nil {
+			err = releaseErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, &LockedError{RetryAfter: until.Sub(now)}
+	}
+
+	return a, nil
+}
+
+// succeeded сбрасывает неудачи по логину; попытка по IP возвращается, но
+// счётчик IP не сбрасывается, чтобы удачный вход в свой аккаунт не
+// обнулял перебор чужих.
+func (a *attempt) succeeded(ctx context.Context) error {
+	for _, item := range a.scopes {
+		var err error
+		if item.scope == store.ScopeLogin {
+			err = a.storage.ClearLoginAttempts(ctx, item.scope, item.key)
+		} else {
+			err = a.storage.ReleaseLoginAttempt(ctx, item.scope, item.key, a.lockFor(item.scope))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// release возвращает попытку: секрет не проверялся или попытка неудачей
+// не считается (пароль верен, но нужен код второго фактора).
+func (a *attempt) release(ctx context.Context) error {
+	for _, item := range a.scopes {
+		if err := a.storage.ReleaseLoginAttempt(ctx, item.scope, item.key, a.lockFor(item.scope)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockFor — на сколько закрыть вход после failures неудач подряд.
+func (a *attempt) lockFor(scope string) func(failures int) time.Duration {
+	if scope == store.ScopeIP {
+		return func(failures int) time.Duration {
+			if failures >= a.cfg.LoginIPMaxFailures {
+				return a.cfg.LoginLockout
+			}
+			return 0
+		}
+	}
+	return func(failures int) time.Duration {
+		return loginDelay(a.cfg, failures)
+	}
+}
+
+// loginDelay — 0 для первых cfg.LoginFreeAttempts неудач, затем 1s, 2s, 4s…
+// (не больше maxLoginDelay), с cfg.LoginMaxFailures — cfg.LoginLockout.
+func loginDelay(cfg config.Config, failures int) time.Duration {
+	switch {
+	case failures >= cfg.LoginMaxFailures:
+		return cfg.LoginLockout
+	case failures <= cfg.LoginFreeAttempts:
+		return 0
+	}
+
+	delay := time.Second
+	for i := cfg.LoginFreeAttempts + 1; i < failures && delay < maxLoginDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxLoginDelay {
+		delay = maxLoginDelay
+	}
+	return delay
+}
+
+// UnlockLogin снимает блокировку входа с логина (в любом регистре) и,
+// если задан, адреса.
+func UnlockLogin(ctx context.Context, storage store.Storage, login string, ip string) error {
+	for _, item := range loginScopes(validation.NormalizeLogin(login), ip) {
+		if err := storage.ClearLoginAttempts(ctx, item.scope, item.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type loginScope struct {
+	scope string
+	key   string
+}
+
+func loginScopes(login string, ip string) []loginScope {
+	var out []loginScope
+	if login != "" {
+		out = append(out, loginScope{scope: store.ScopeLogin, key: login})
+	}
+	if ip != "" {
+		out = append(out, loginScope{scope: store.ScopeIP, key: ip})
+	}
+	return out
+}
+
+// ClientIP — адрес клиента из соединения. Заголовкам X-Forwarded-For
+// не доверяем: их подделка обошла бы учёт по IP.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RequireRole пропускает только пользователей с ролью role; ставится
+// после CheckAuthorized.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !HasRole(r.Context(), role) {
+				problem.Write(w, r, http.StatusForbidden, problem.CodeForbidden, "role "+role+" required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/notify"
+	"diplom_ya/internal/password"
+	"diplom_ya/internal/store"
+	"diplom_ya/internal/validation"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrWrongPassword — текущий пароль введён неверно.
+	ErrWrongPassword = errors.New("auth: wrong password")
+	// ErrResetInvalid — токен сброса неизвестен, истёк или уже использован.
+	ErrResetInvalid = errors.New("auth: invalid reset token")
+)
+
+// ChangePassword меняет пароль пользователя после проверки текущего и
+// отзывает все его сессии и токены. Проверка текущего пароля идёт через
+// те же счётчики неудач, что и вход. Ошибка — ErrWrongPassword,
+// *LockedError, validation.Errors для нового пароля или ошибка хранилища.
+func ChangePassword(ctx context.Context, cfg config.Config, storage store.Storage, userID string, current string, next string, ip string) error {
+	login, hash, err := storage.ReadUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if login == "" {
+		return ErrWrongPassword
+	}
+
+	guard, err := beginAttempt(ctx, cfg, storage, validation.NormalizeLogin(login), ip)
+	if err != nil {
+		return err
+	}
+
+	ok, err := checkPassword(ctx, cfg, storage, userID, login, current, hash)
+	if err != nil {
+		if releaseErr := guard.release(ctx); releaseErr != nil {
+			return releaseErr
+		}
+		return err
+	}
+	if !ok {
+		// неудача уже засчитана
+		return ErrWrongPassword
+	}
+	if err := guard.succeeded(ctx); err != nil {
+		return err
+	}
+
+	if err := validation.Password(cfg, "new_password", login, next); err != nil {
+		return err
+	}
+
+	newHash, err := hashPassword(cfg, next)
+	if err != nil {
+		return err
+	}
+	if err := storage.UpdatePasswordHash(ctx, userID, newHash); err != nil {
+		return err
+	}
+
+	return revokeAll(ctx, storage, userID)
+}
+
+// RequestPasswordReset выдаёт одноразовый токен сброса пароля на
+// cfg.PasswordResetTTL и отправляет его пользователю. Для неизвестного
+// логина ничего не делает и ошибки не возвращает, чтобы по ответу нельзя
+// было узнать, есть ли такой пользователь.
+func RequestPasswordReset(ctx context.Context, cfg config.Config, storage store.Storage, notifier notify.Notifier, login string) error {
+	login = validation.NormalizeLogin(login)
+
+	userID, _, err := storage.ReadUser(ctx, login)
+	if err != nil || userID == "" {
+		return err
+	}
+
+	raw, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	reset := store.PasswordReset{
+		Hash:      hashToken(raw),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(cfg.PasswordResetTTL),
+	}
+	if err := storage.CreatePasswordReset(ctx, reset); err != nil {
+		return err
+	}
+
+	return notifier.Notify(ctx, notify.Message{
+		To:      login,
+		Subject: "Сброс пароля",
+		Body:    fmt.Sprintf("Токен сброса пароля: %s\nДействует до %s.", raw, reset.ExpiresAt.Format(time.RFC3339)),
+		Date:    now,
+	})
+}
+
+// ResetPassword ставит новый пароль по токену сброса, гасит все токены
+// сброса пользователя, отзывает его сессии и токены и снимает блокировку входа.
+// Ошибка — ErrResetInvalid, validation.Errors или ошибка хранилища.
+func ResetPassword(ctx context.Context, cfg config.Config, storage store.Storage, token string, next string) error {
+	if token == "" {
+		return ErrResetInvalid
+	}
+	hash := hashToken(token)
+
+	// пароль проверяется до погашения токена: отклонённый пароль не
+	// должен сжигать токен
+	userID, err := storage.GetPasswordReset(ctx, hash)
+	if err != nil {
+		return err
+	}
+	if userID == "" {
+		return ErrResetInvalid
+	}
+	login, _, err := storage.ReadUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := validation.Password(cfg, "new_password", login, next); err != nil {
+		return err
+	}
+
+	newHash, err := hashPassword(cfg, next)
+	if err != nil {
+		return err
+	}
+	userID, err = storage.ResetPassword(ctx, hash, newHash)
+	if err != nil {
+		return err
+	}
+	if userID == "" {
+		return ErrResetInvalid
+	}
+
+	if err := revokeAll(ctx, storage, userID); err != nil {
+		return err
+	}
+	return storage.ClearLoginAttempts(ctx, store.ScopeLogin, validation.NormalizeLogin(login))
+}
+
+func hashPassword(cfg config.Config, pass string) (string, error) {
+	hasher, err := password.New(cfg)
+	if err != nil {
+		return "", err
+	}
+	return hasher.Hash(pass)
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/cookie"
+	"diplom_ya/internal/store"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// cookie с refresh-токеном для браузерных клиентов
+const refreshCookie = "refresh"
+
+// ErrRefreshInvalid — refresh-токен неизвестен, истёк, отозван или повторён.
+var ErrRefreshInvalid = errors.New("auth: invalid refresh token")
+
+// Refresh — выданный refresh-токен и сессия, которую с ним открывают.
+type Refresh struct {
+	UserID    string
+	SessionID string
+	Token     string
+	ExpiresAt time.Time
+}
+
+// IssueRefreshToken начинает новое семейство refresh-токенов пользователя.
+func IssueRefreshToken(ctx context.Context, cfg config.Config, storage store.Storage, userID string) (Refresh, error) {
+	raw, record, err := newRefreshToken(cfg)
+	if err != nil {
+		return Refresh{}, err
+	}
+	record.FamilyID = uuid.New().String()
+	record.UserID = userID
+
+	if err := storage.CreateRefreshToken(ctx, record); err != nil {
+		return Refresh{}, err
+	}
+	return Refresh{UserID: userID, SessionID: record.SessionID, Token: raw, ExpiresAt: record.ExpiresAt}, nil
+}
+
+// RotateRefreshToken обменивает refresh-токен на новый того же семейства,
+// сессия старого токена при этом закрывается. Повтор уже обменянного
+// токена — признак кражи: семейство, его сессии и access-токены
+// пользователя отзываются, и ни вор, ни владелец не продолжат без нового
+// входа.
+func RotateRefreshToken(ctx context.Context, cfg config.Config, storage store.Storage, raw string) (Refresh, error) {
+	if raw == "" {
+		return Refresh{}, ErrRefreshInvalid
+	}
+
+	next, record, err := newRefreshToken(cfg)
+	if err != nil {
+		return Refresh{}, err
+	}
+
+	old, err := storage.RotateRefreshToken(ctx, hashToken(raw), record)
+	switch {
+	case errors.Is(err, store.ErrRefreshReused):
+		log.Printf("auth: spent refresh token presented, family %s revoked", old.FamilyID)
+		if err := RevokeAccessTokens(ctx, storage, old.UserID); err != nil {
+			return Refresh{}, err
+		}
+		return Refresh{}, ErrRefreshInvalid
+	case err != nil:
+		return Refresh{}, err
+	case old.UserID == "":
+		return Refresh{}, ErrRefreshInvalid
+	}
+
+	return Refresh{UserID: old.UserID, SessionID: record.SessionID, Token: next, ExpiresAt: record.ExpiresAt}, nil
+}
+
+// RevokeRefreshToken отзывает семейство токена raw.
+func RevokeRefreshToken(ctx context.Context, storage store.Storage, raw string) error {
+	if raw == "" {
+		return nil
+	}
+	return storage.RevokeRefreshFamily(ctx, hashToken(raw))
+}
+
+// RefreshTokenFromRequest — refresh-токен из cookie, если клиент не
+// передал его явно.
+func RefreshTokenFromRequest(r *http.Request, raw string) string {
+	if raw != "" {
+		return raw
+	}
+	return cookie.GetSecretCookie(r, refreshCookie)
+}
+
+// SetRefreshCookie отдаёт refresh-токен браузерному клиенту в cookie.
+func SetRefreshCookie(cfg config.Config, w http.ResponseWriter, refresh Refresh) {
+	cookie.AddSecretCookie(cfg, refreshCookie, refresh.Token, refresh.ExpiresAt, w)
+}
+
+// EndAllSessions отзывает все сессии, refresh- и access-токены пользователя.
+func EndAllSessions(ctx context.Context, cfg config.Config, storage store.Storage, w http.ResponseWriter, userID string) error {
+	if err := revokeAll(ctx, storage, userID); err != nil {
+		return err
+	}
+
+	cookie.DeleteCookie(cfg, sessionCookie, w)
+	cookie.DeleteCookie(cfg, refreshCookie, w)
+	return nil
+}
+
+func newRefreshToken(cfg config.Config) (string, store.RefreshToken, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return "", store.RefreshToken{}, err
+	}
+
+	now := time.Now()
+	record := store.RefreshToken{
+		Hash:      hashToken(raw),
+		SessionID: uuid.New().String(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(cfg.RefreshTTL),
+	}
+	return raw, record, nil
+}
+
+// revokeAll отзывает сессии, refresh- и access-токены пользователя.
+func revokeAll(ctx context.Context, storage store.Storage, userID string) error {
+	if err := storage.RevokeUserSessions(ctx, userID); err != nil {
+		return err
+	}
+	if err := storage.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return err
+	}
+	return RevokeAccessTokens(ctx, storage, userID)
+}
+
+// randomToken — 256 случайных бит; в хранилище попадает только хеш.
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// токен случаен и длинен, поэтому соли и медленного хеша не нужно
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"context"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/cookie"
+	"diplom_ya/internal/store"
+	"net/http"
+	"time"
+)
+
+// cookie с подписанным идентификатором сессии
+const sessionCookie = "session"
+
+type ctxKey int
+
+const (
+	ctxUserID ctxKey = iota
+	ctxSessionID
+	ctxRoles
+)
+
+// UserFromContext возвращает пользователя, проверенного CheckAuthorized.
+func UserFromContext(ctx context.Context) (string, bool) {
+	userID, ok := ctx.Value(ctxUserID).(string)
+	return userID, ok && userID != ""
+}
+
+// SessionFromContext возвращает идентификатор текущей сессии.
+func SessionFromContext(ctx context.Context) (string, bool) {
+	sessionID, ok := ctx.Value(ctxSessionID).(string)
+	return sessionID, ok && sessionID != ""
+}
+
+// RolesFromContext возвращает роли пользователя запроса.
+func RolesFromContext(ctx context.Context) []string {
+	roles, _ := ctx.Value(ctxRoles).([]string)
+	return roles
+}
+
+// HasRole — есть ли у пользователя запроса роль role.
+func HasRole(ctx context.Context, role string) bool {
+	for _, item := range RolesFromContext(ctx) {
+		if item == role {
+			return true
+		}
+	}
+	return false
+}
+
+func withUser(ctx context.Context, userID string, roles []string) context.Context {
+	ctx = context.WithValue(ctx, ctxUserID, userID)
+	return context.WithValue(ctx, ctxRoles, roles)
+}
+
+func withSession(ctx context.Context, session store.Session, roles []string) context.Context {
+	ctx = withUser(ctx, session.UserID, roles)
+	return context.WithValue(ctx, ctxSessionID, session.ID)
+}
+
+// StartSession открывает сессию refresh.SessionID на cfg.SessionTTL и
+// ставит cookie с её подписанным идентификатором.
+func StartSession(ctx context.Context, cfg config.Config, storage store.Storage, w http.ResponseWriter, refresh Refresh) error {
+	now := time.Now()
+	session := store.Session{
+		ID:        refresh.SessionID,
+		UserID:    refresh.UserID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(cfg.SessionTTL),
+	}
+	if err := storage.CreateSession(ctx, session); err != nil {
+		return err
+	}
+
+	cookie.AddCookie(cfg, sessionCookie, session.ID, session.ExpiresAt, w)
+	return nil
+}
+
+// EndSession отзывает текущую сессию, семейство refresh-токена
+// refreshToken и access-токены пользователя и удаляет cookie. Поштучно
+// access-токены не отзываются: гаснут все, другие клиенты обменяют свои
+// refresh-токены на новые.
+func EndSession(ctx context.Context, cfg config.Config, storage store.Storage, w http.ResponseWriter, refreshToken string) error {
+	if sessionID, ok := SessionFromContext(ctx); ok {
+		if err := storage.RevokeSession(ctx, sessionID); err != nil {
+			return err
+		}
+	}
+	if err := RevokeRefreshToken(ctx, storage, refreshToken); err != nil {
+		return err
+	}
+	if userID, ok := UserFromContext(ctx); ok {
+		if err := RevokeAccessTokens(ctx, storage, userID); err != nil {
+			return err
+		}
+	}
+
+	cookie.DeleteCookie(cfg, sessionCookie, w)
+	cookie.DeleteCookie(cfg, refreshCookie, w)
+	return nil
+}
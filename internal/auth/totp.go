@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/encryption"
+	"diplom_ya/internal/store"
+	"diplom_ya/internal/totp"
+	"diplom_ya/internal/validation"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTOTPRequired — пароль верен, но у пользователя включён второй
+	// фактор, а код не передан.
+	ErrTOTPRequired = errors.New("auth: one-time code required")
+	// ErrTOTPInvalid — код неверен, уже использован или второй фактор не включён.
+	ErrTOTPInvalid = errors.New("auth: invalid one-time code")
+	// ErrTOTPEnabled — второй фактор уже включён.
+	ErrTOTPEnabled = errors.New("auth: totp already enabled")
+	// ErrTOTPNotStarted — секрет не выдан: сначала BeginTOTP.
+	ErrTOTPNotStarted = errors.New("auth: totp enrollment not started")
+	// ErrTOTPDisabled — ENCRYPTION_KEYS не задан: секреты TOTP нечем
+	// зашифровать и расшифровать.
+	ErrTOTPDisabled = errors.New("auth: totp disabled, ENCRYPTION_KEYS is not set")
+)
+
+// сколько кодов восстановления выдаётся
+const recoveryCodes = 10
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Enrollment — секрет TOTP для приложения-аутентификатора.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// BeginTOTP выдаёт пользователю новый секрет. Второй фактор включится
+// после ConfirmTOTP; повторный вызов до подтверждения заменяет секрет.
+// Без ENCRYPTION_KEYS BeginTOTP, ConfirmTOTP и RegenerateRecoveryCodes
+// возвращают ErrTOTPDisabled.
+func BeginTOTP(ctx context.Context, cfg config.Config, storage store.Storage, userID string) (Enrollment, error) {
+	if cfg.EncryptionKeys == nil {
+		return Enrollment{}, ErrTOTPDisabled
+	}
+
+	login, _, err := storage.ReadUserByID(ctx, userID)
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return Enrollment{}, err
+	}
+	sealed, err := encryption.Seal([]byte(secret), cfg.EncryptionKeys)
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	err = storage.SetTOTPSecret(ctx, userID, sealed)
+	if errors.Is(err, store.ErrDuplicate) {
+		return Enrollment{}, ErrTOTPEnabled
+	}
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	return Enrollment{Secret: secret, URI: totp.URI(cfg.TOTPIssuer, login, secret)}, nil
+}
+
+// ConfirmTOTP включает второй фактор по первому коду из приложения и
+// возвращает коды восстановления — они показываются один раз.
+func ConfirmTOTP(ctx context.Context, cfg config.Config, storage store.Storage, userID string, code string) ([]string, error) {
+	if cfg.EncryptionKeys == nil {
+		return nil, ErrTOTPDisabled
+	}
+
+	state, err := storage.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case state.Secret == "":
+		return nil, ErrTOTPNotStarted
+	case state.Enabled:
+		return nil, ErrTOTPEnabled
+	}
+
+	secret, err := openSecret(cfg, state.Secret)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(string(secret), code, time.Now(), cfg.TOTPSkew)
+	if !ok {
+		return nil, ErrTOTPInvalid
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := storage.EnableTOTP(ctx, userID, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		// параллельное подтверждение успело раньше
+		return nil, ErrTOTPEnabled
+	}
+	return codes, nil
+}
+
+// DisableTOTP выключает второй фактор; нужен действующий код или код
+// восстановления. Неверный код засчитывается неудачей входа.
+func DisableTOTP(ctx context.Context, cfg config.Config, storage store.Storage, userID string, code string, ip string) error {
+	if err := guardSecondFactor(ctx, cfg, storage, userID, code, ip); err != nil {
+		return err
+	}
+	return storage.DeleteTOTP(ctx, userID)
+}
+
+// RegenerateRecoveryCodes заменяет коды восстановления новыми; нужен
+// действующий код или код восстановления. Неверный код засчитывается
+// неудачей входа.
+func RegenerateRecoveryCodes(ctx context.Context, cfg config.Config, storage store.Storage, userID string, code string, ip string) ([]string, error) {
+	if cfg.EncryptionKeys == nil {
+		return nil, ErrTOTPDisabled
+	}
+	if err := guardSecondFactor(ctx, cfg, storage, userID, code, ip); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// secondFactor проверяет второй фактор при входе: nil, если он не
+// включён или код верен.
+func secondFactor(ctx context.Context, cfg config.Config, storage store.Storage, userID string, code string) error {
+	state, err := storage.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !state.Enabled {
+		return nil
+	}
+	if code == "" {
+		return ErrTOTPRequired
+	}
+	return verifySecondFactor(ctx, cfg, storage, state, code)
+}
+
+// guardSecondFactor — checkSecondFactor под защитой от перебора: код
+// проверяется на тех же счётчиках по логину и IP, что и пароль при входе,
+// пока вход закрыт — *LockedError.
+func guardSecondFactor(ctx context.Context, cfg config.Config, storage store.Storage, userID string, code string, ip string) error {
+	login, _, err := storage.ReadUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	guard, err := beginAttempt(ctx, cfg, storage, validation.NormalizeLogin(login), ip)
+	if err != nil {
+		return err
+	}
+
+	err = checkSecondFactor(ctx, cfg, storage, userID, code)
+	switch {
+	case err == nil:
+		return guard.succeeded(ctx)
+	case errors.Is(err, ErrTOTPInvalid):
+		// неудача уже засчитана
+		return err
+	}
+	if releaseErr := guard.release(ctx); releaseErr != nil {
+		return releaseErr
+	}
+	return err
+}
+
+// openSecret расшифровывает секрет TOTP набором ENCRYPTION_KEYS; без него
+// коды из приложения не проверить — ErrTOTPDisabled, но коды
+// восстановления по-прежнему принимаются.
+func openSecret(cfg config.Config, sealed string) ([]byte, error) {
+	if cfg.EncryptionKeys == nil {
+		return nil, ErrTOTPDisabled
+	}
+	return encryption.Open(sealed, cfg.EncryptionKeys)
+}
+
+// checkSecondFactor требует включённый второй фактор и верный код.
+func checkSecondFactor(ctx context.Context, cfg config.Config, storage store.Storage, userID string, code string) error {
+	state, err := storage.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !state.Enabled {
+		return ErrTOTPInvalid
+	}
+	return verifySecondFactor(ctx, cfg, storage, state, code)
+}
+
+// verifySecondFactor принимает код из приложения (6 цифр; каждый шаг
+// времени — один раз) или код восстановления (одноразовый).
+func verifySecondFactor(ctx context.Context, cfg config.Config, storage store.Storage, state store.TOTP, code string) error {
+	code = strings.TrimSpace(code)
+
+	if len(code) == 6 && strings.Trim(code, "0123456789") == "" {
+		secret, err := openSecret(cfg, state.Secret)
+		if err != nil {
+			return err
+		}
+		step, ok := totp.Validate(string(secret), code, time.Now(), cfg.TOTPSkew)
+		if !ok {
+			return ErrTOTPInvalid
+		}
+		fresh, err := storage.UseTOTPStep(ctx, state.UserID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrTOTPInvalid
+		}
+		return nil
+	}
+
+	ok, err := storage.UseRecoveryCode(ctx, state.UserID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrTOTPInvalid
+	}
+	return nil
+}
+
+// newRecoveryCodes — коды восстановления вида xxxx-xxxx-xxxx-xxxx и их хеши
+// для хранилища.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodes)
+	hashes := make([]string, 0, recoveryCodes)
+
+	for i := 0; i < recoveryCodes; i++ {
+		buf := make([]byte, 10)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(buf))
+		codes = append(codes, raw[0:4]+"-"+raw[4:8]+"-"+raw[8:12]+"-"+raw[12:16])
+		hashes = append(hashes, hashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode убирает дефисы и пробелы и приводит регистр.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
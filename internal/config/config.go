@@ -1,22 +1,93 @@
 package config
 
 import (
-	"database/sql"
+	"bufio"
+	"diplom_ya/internal/jwks"
+	"diplom_ya/internal/keyring"
+	"diplom_ya/internal/money"
 	"flag"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/caarlos0/env"
 )
 
 type Config struct {
-	RunAddress     string `env:"RUN_ADDRESS" envDefault:"localhost:9090"`
-	DataBase       string `env:"DATABASE_URI"`
+	RunAddress string `env:"RUN_ADDRESS" envDefault:"localhost:9090"`
+	DataBase   string `env:"DATABASE_URI"`
+	// хранилище: postgres (DATABASE_URI) или memory — в памяти, данные теряются при остановке
+	Storage        string `env:"STORAGE" envDefault:"postgres"`
 	AccrualAddress string `env:"ACCRUAL_SYSTEM_ADDRESS" envDefault:"http://localhost:8080"`
-	ConnectDB      *sql.DB
-	Key            string
+	// клиент системы расчёта начислений
+	AccrualWorkers          int           `env:"ACCRUAL_WORKERS" envDefault:"4"`
+	AccrualTimeout          time.Duration `env:"ACCRUAL_TIMEOUT" envDefault:"5s"`
+	AccrualRetries          int           `env:"ACCRUAL_RETRIES" envDefault:"3"`
+	AccrualBreakerThreshold int           `env:"ACCRUAL_BREAKER_THRESHOLD" envDefault:"5"`
+	AccrualBreakerCooldown  time.Duration `env:"ACCRUAL_BREAKER_COOLDOWN" envDefault:"30s"`
+	// хеширование паролей: argon2id или bcrypt; 0 — параметры по умолчанию
+	PasswordHasher string `env:"PASSWORD_HASHER" envDefault:"argon2id"`
+	Argon2Memory   int    `env:"ARGON2_MEMORY"` // KiB
+	Argon2Time     int    `env:"ARGON2_TIME"`
+	Argon2Threads  int    `env:"ARGON2_THREADS"`
+	BcryptCost     int    `env:"BCRYPT_COST"`
+	// сессии: короткая сессия продлевается refresh-токеном;
+	// Secure у cookie включать за HTTPS
+	SessionTTL   time.Duration `env:"SESSION_TTL" envDefault:"15m"`
+	RefreshTTL   time.Duration `env:"REFRESH_TTL" envDefault:"720h"`
+	CookieSecure bool          `env:"COOKIE_SECURE" envDefault:"false"`
+	// правила регистрации, см. internal/validation
+	LoginMinLength       int    `env:"LOGIN_MIN_LENGTH" envDefault:"3"`
+	LoginMaxLength       int    `env:"LOGIN_MAX_LENGTH" envDefault:"64"`
+	PasswordMinLength    int    `env:"PASSWORD_MIN_LENGTH" envDefault:"8"`
+	PasswordMaxLength    int    `env:"PASSWORD_MAX_LENGTH" envDefault:"128"`
+	PasswordMinClasses   int    `env:"PASSWORD_MIN_CLASSES" envDefault:"2"`
+	PasswordDenyListFile string `env:"PASSWORD_DENYLIST_FILE"`
+	PasswordDenyList     map[string]bool
+	// сброс пароля: срок токена и доставка (log или file), см. internal/notify
+	PasswordResetTTL time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"1h"`
+	Notifier         string        `env:"NOTIFIER" envDefault:"log"`
+	NotifierFile     string        `env:"NOTIFIER_FILE"`
+	// второй фактор: издатель в otpauth-ссылке и допуск расхождения часов в шагах по 30s
+	TOTPIssuer string `env:"TOTP_ISSUER" envDefault:"gophermart"`
+	TOTPSkew   int    `env:"TOTP_SKEW" envDefault:"1"`
+	// защита входа от перебора: первые LOGIN_FREE_ATTEMPTS неудач без задержки,
+	// дальше задержка 1s, 2s, 4s…, с LOGIN_MAX_FAILURES неудач по логину или
+	// LOGIN_IP_MAX_FAILURES по IP — блокировка на LOGIN_LOCKOUT
+	LoginFreeAttempts  int           `env:"LOGIN_FREE_ATTEMPTS" envDefault:"3"`
+	LoginMaxFailures   int           `env:"LOGIN_MAX_FAILURES" envDefault:"10"`
+	LoginIPMaxFailures int           `env:"LOGIN_IP_MAX_FAILURES" envDefault:"50"`
+	LoginFailureWindow time.Duration `env:"LOGIN_FAILURE_WINDOW" envDefault:"15m"`
+	LoginLockout       time.Duration `env:"LOGIN_LOCKOUT" envDefault:"15m"`
+	// JWT для Authorization: Bearer; без JWT_KEYS_FILE токены не выдаются
+	JWTKeysFile string        `env:"JWT_KEYS_FILE"`
+	JWTIssuer   string        `env:"JWT_ISSUER" envDefault:"gophermart"`
+	JWTAudience string        `env:"JWT_AUDIENCE" envDefault:"gophermart"`
+	JWTTTL      time.Duration `env:"JWT_TTL" envDefault:"15m"`
+	JWTKeys     *jwks.KeySet
+	// часовой пояс времени в ответах (имя из базы IANA) и дат без времени в фильтрах
+	DisplayTimezone string `env:"DISPLAY_TIMEZONE" envDefault:"UTC"`
+	DisplayLocation *time.Location
+	// списки заказов и списаний: записей на странице по умолчанию и не больше
+	PageLimit    int `env:"PAGE_LIMIT" envDefault:"100"`
+	PageMaxLimit int `env:"PAGE_MAX_LIMIT" envDefault:"1000"`
+	// проверка запросов (request) или запросов и ответов (all) по internal/openapi/openapi.json; off — без проверки
+	OpenAPIValidate string `env:"OPENAPI_VALIDATE" envDefault:"off"`
+	// сколько ждать завершения запросов и фоновой обработки при остановке
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" envDefault:"30s"`
+	// период сверки балансов с журналом проводок, 0 — не сверять
+	ReconcileInterval time.Duration `env:"RECONCILE_INTERVAL" envDefault:"1h"`
+	// секретные ключи по назначениям, см. internal/keyring;
+	// без ENCRYPTION_KEYS (шифрование секретов TOTP) второй фактор выключен
+	KeysFile           string `env:"KEYS_FILE"`
+	SessionKeysSpec    string `env:"SESSION_KEYS"`
+	MACKeysSpec        string `env:"MAC_KEYS"`
+	EncryptionKeysSpec string `env:"ENCRYPTION_KEYS"`
+	SessionKeys        *keyring.Ring
+	MACKeys            *keyring.Ring
+	EncryptionKeys     *keyring.Ring
 	OrdersStatus
-	ChanOrdersProc chan string
 }
 
 type OrdersStatus struct {
@@ -28,24 +99,23 @@ type OrdersStatus struct {
 }
 
 type OutAccum struct {
-	Order  string    `json:"number"`
-	Status string    `json:"status"`
-	Sum    float32   `json:"accrual,omitempty"`
-	Date   time.Time `json:"uploaded_at"`
+	Order  string       `json:"number"`
+	Status string       `json:"status"`
+	Sum    money.Amount `json:"accrual,omitempty"`
+	Date   time.Time    `json:"uploaded_at"`
 }
 
 type OutWithdrawals struct {
-	Order string    `json:"order"`
-	Sum   float32   `json:"accrual"`
-	Date  time.Time `json:"processed_at"`
+	Order  string       `json:"order"`
+	Sum    money.Amount `json:"sum"`
+	Date   time.Time    `json:"processed_at"`
+	Status string       `json:"status"` // pending, completed или reversed
 }
 
 func New() Config {
 
 	var cfg Config
 
-	cfg.Key = "10c57de0"
-
 	if err := env.Parse(&cfg); err != nil {
 		log.Fatal(err)
 	}
@@ -53,9 +123,49 @@ func New() Config {
 	flag.StringVar(&cfg.RunAddress, "a", cfg.RunAddress, "")
 	flag.StringVar(&cfg.DataBase, "d", cfg.DataBase, "")
 	flag.StringVar(&cfg.AccrualAddress, "r", cfg.AccrualAddress, "")
+	flag.IntVar(&cfg.AccrualWorkers, "w", cfg.AccrualWorkers, "")
+	flag.DurationVar(&cfg.ReconcileInterval, "reconcile", cfg.ReconcileInterval, "")
 
 	flag.Parse()
 
+	if err := loadKeys(&cfg); err != nil {
+		log.Fatal(err)
+	}
+
+	if cfg.PasswordDenyListFile != "" {
+		denyList, err := loadDenyList(cfg.PasswordDenyListFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.PasswordDenyList = denyList
+	}
+
+	switch cfg.Storage {
+	case "postgres", "memory":
+	default:
+		log.Fatalf("config: STORAGE must be postgres or memory, got %q", cfg.Storage)
+	}
+
+	switch cfg.OpenAPIValidate {
+	case "off", "request", "all":
+	default:
+		log.Fatalf("config: OPENAPI_VALIDATE must be off, request or all, got %q", cfg.OpenAPIValidate)
+	}
+
+	location, err := time.LoadLocation(cfg.DisplayTimezone)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.DisplayLocation = location
+
+	if cfg.JWTKeysFile != "" {
+		keys, err := jwks.Load(cfg.JWTKeysFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.JWTKeys = keys
+	}
+
 	statuses := OrdersStatus{
 		New:        "NEW",
 		Processing: "PROCESSING",
@@ -66,7 +176,85 @@ func New() Config {
 
 	cfg.OrdersStatus = statuses
 
-	cfg.ChanOrdersProc = make(chan string)
-
 	return cfg
 }
+
+// legacyKey — ключ, зашитый в ранние версии: им посчитаны старые хеши
+// паролей. Он опубликован в исходниках, поэтому стоит только в конце
+// MAC_KEYS для проверки этих хешей и никогда не подписывает.
+var legacyKey = keyring.Key{ID: "legacy", Secret: []byte("10c57de0")}
+
+func loadKeys(cfg *Config) error {
+	rings, err := keyring.Load(cfg.KeysFile, map[string]string{
+		keyring.PurposeSession:    cfg.SessionKeysSpec,
+		keyring.PurposeMAC:        cfg.MACKeysSpec,
+		keyring.PurposeEncryption: cfg.EncryptionKeysSpec,
+	})
+	if err != nil {
+		return err
+	}
+
+	if cfg.SessionKeys, err = activeRing(rings, keyring.PurposeSession, "SESSION_KEYS"); err != nil {
+		return err
+	}
+	if cfg.MACKeys, err = activeRing(rings, keyring.PurposeMAC, "MAC_KEYS"); err != nil {
+		return err
+	}
+	if _, dup := cfg.MACKeys.Lookup(legacyKey.ID); !dup {
+		if cfg.MACKeys, err = cfg.MACKeys.With(legacyKey); err != nil {
+			return err
+		}
+	}
+
+	// зашифрованное случайным ключом процесса терялось бы при перезапуске,
+	// а встроенным — было бы открытым текстом, поэтому без ключа второй
+	// фактор выключен, а не шифруется чем попало
+	ring, ok := rings[keyring.PurposeEncryption]
+	if !ok {
+		log.Printf("config: ENCRYPTION_KEYS is not set, TOTP is disabled: " +
+			"set it (kid:secret, secret of at least 32 bytes) to let users enable the second factor")
+		return nil
+	}
+	cfg.EncryptionKeys = ring
+	return nil
+}
+
+// activeRing — набор назначения purpose. Без заданных ключей подписывает
+// случайный ключ процесса: подписанное им не переживёт перезапуск и не
+// примется другими экземплярами сервиса.
+func activeRing(rings map[string]*keyring.Ring, purpose string, env string) (*keyring.Ring, error) {
+	ring, ok := rings[purpose]
+	if !ok {
+		key, err := keyring.Random("ephemeral")
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("config: WARNING: %s is not set, %s keys are generated at startup: "+
+			"signed values are lost on restart and differ between instances; set %s in production", env, purpose, env)
+		if ring, err = keyring.New(key); err != nil {
+			return nil, err
+		}
+	}
+	return ring, nil
+}
+
+// loadDenyList читает файл распространённых паролей: по одному в строке,
+// пустые строки и строки с # пропускаются, регистр не различается.
+func loadDenyList(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	out := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out[strings.ToLower(line)] = true
+	}
+	return out, scanner.Err()
+}
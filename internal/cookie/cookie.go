@@ -4,24 +4,70 @@ import (
 	"diplom_ya/internal/config"
 	"diplom_ya/internal/encryption"
 	"net/http"
+	"time"
 )
 
+// GetCookie возвращает значение подписанной cookie или "", если cookie нет,
+// она повреждена, подпись неверна или срок истёк.
 func GetCookie(r *http.Request, cfg config.Config, name string) string {
-	value := ""
-	if cookie, err := r.Cookie(name); err == nil {
-		value, err = encryption.Decrypt(cookie.Value, cfg)
-		if err != nil {
-			value = cookie.Value
-		}
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	value, err := encryption.Decode(cookie.Value, time.Now(), cfg.SessionKeys)
+	if err != nil {
+		return ""
 	}
 	return value
 }
 
-func AddCookie(name string, value string, w http.ResponseWriter, r *http.Request) {
-	newCookie := &http.Cookie{
-		Name:  name,
-		Value: value,
+// AddCookie подписывает value и ставит cookie до expires.
+func AddCookie(cfg config.Config, name string, value string, expires time.Time, w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    encryption.Encode(value, expires, cfg.SessionKeys),
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(time.Until(expires).Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// GetSecretCookie возвращает значение cookie как есть — для значений,
+// которые сами являются случайным секретом и проверяются сервером.
+func GetSecretCookie(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
 	}
-	http.SetCookie(w, newCookie)
-	r.AddCookie(newCookie)
+	return cookie.Value
+}
+
+// AddSecretCookie ставит cookie со значением без подписи.
+func AddSecretCookie(cfg config.Config, name string, value string, expires time.Time, w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		MaxAge:   int(time.Until(expires).Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// DeleteCookie удаляет cookie в браузере.
+func DeleteCookie(cfg config.Config, name string, w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   cfg.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
 }
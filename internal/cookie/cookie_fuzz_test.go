@@ -0,0 +1,72 @@
+//go:build go1.18
+// +build go1.18
+
+package cookie
+
+import (
+	"diplom_ya/internal/encryption"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// FuzzGetCookie: произвольное значение cookie не роняет GetCookie, а принятое
+// значение — всегда токен версии 1 с неистёкшим сроком и подписью ключа набора.
+func FuzzGetCookie(f *testing.F) {
+	cfg := testConfig(f)
+	now := time.Now()
+
+	f.Add(encryption.Encode("6ba7b810-9dad-11d1-80b4-00c04fd430c8", now.Add(time.Hour), cfg.SessionKeys))
+	f.Add(encryption.Encode("", now.Add(time.Hour), cfg.SessionKeys))
+	f.Add(encryption.Encode("value", now.Add(-time.Hour), cfg.SessionKeys))
+	f.Add("k1.00ff.6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	f.Add(strings.Repeat("0", 64) + "6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	f.Add("v1....")
+	f.Add("v1.k1.-1.AA.AA")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		value := GetCookie(requestWithCookie(raw), cfg, "session")
+		if value == "" {
+			return
+		}
+
+		parts := strings.Split(raw, ".")
+		if len(parts) != 5 || parts[0] != "v1" {
+			t.Fatalf("accepted unversioned token %q", raw)
+		}
+		if _, ok := cfg.SessionKeys.Lookup(parts[1]); !ok {
+			t.Fatalf("accepted token with unknown kid %q", raw)
+		}
+		decoded, err := base64.RawURLEncoding.DecodeString(parts[3])
+		if err != nil || string(decoded) != value {
+			t.Fatalf("GetCookie(%q) = %q, token carries %q", raw, value, decoded)
+		}
+	})
+}
+
+// FuzzCookieRoundTrip: значение, поставленное AddCookie, читается GetCookie
+// без изменений.
+func FuzzCookieRoundTrip(f *testing.F) {
+	cfg := testConfig(f)
+
+	f.Add("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	f.Add("")
+	f.Add("a.b.c")
+
+	f.Fuzz(func(t *testing.T, value string) {
+		w := httptest.NewRecorder()
+		AddCookie(cfg, "session", value, time.Now().Add(time.Hour), w)
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, item := range w.Result().Cookies() {
+			r.AddCookie(item)
+		}
+		if got := GetCookie(r, cfg, "session"); got != value {
+			t.Fatalf("GetCookie after AddCookie(%q) = %q", value, got)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package cookie
+
+import (
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/encryption"
+	"diplom_ya/internal/keyring"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testConfig(t testing.TB) config.Config {
+	keys, err := keyring.New(
+		keyring.Key{ID: "k1", Secret: []byte(strings.Repeat("1", 32))},
+		keyring.Key{ID: "k0", Secret: []byte(strings.Repeat("0", 32))},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config.Config{SessionKeys: keys}
+}
+
+func requestWithCookie(value string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Cookie", "session="+value)
+	return r
+}
+
+func TestGetCookie(t *testing.T) {
+	cfg := testConfig(t)
+	now := time.Now()
+	uuid := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+	valid := encryption.Encode(uuid, now.Add(time.Hour), cfg.SessionKeys)
+	parts := strings.Split(valid, ".")
+
+	other, err := keyring.New(keyring.Key{ID: "k2", Secret: []byte(strings.Repeat("2", 32))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := keyring.New(keyring.Key{ID: "legacy", Secret: []byte("10c57de0")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"valid", valid, uuid},
+		{"second key of the ring", encryption.Encode(uuid, now.Add(time.Hour), testRotated(t, cfg)), uuid},
+		{"empty", "", ""},
+		{"expired", encryption.Encode(uuid, now.Add(-time.Hour), cfg.SessionKeys), ""},
+		{"unknown key", encryption.Encode(uuid, now.Add(time.Hour), other), ""},
+		{"legacy key", encryption.Encode(uuid, now.Add(time.Hour), legacy), ""},
+		{"tampered value", strings.Join([]string{parts[0], parts[1], parts[2], "b3RoZXI", parts[4]}, "."), ""},
+		{"truncated signature", valid[:len(valid)-2], ""},
+		{"unversioned kid.hex.value", "k1.00ff." + uuid, ""},
+		{"unversioned hex+uuid", strings.Repeat("0", 64) + uuid, ""},
+		{"empty parts", "v1....", ""},
+		{"negative expiry", "v1.k1.-1.AA.AA", ""},
+		{"extra part", valid + ".x", ""},
+		{"not a token", "garbage", ""},
+	}
+	for _, tt := range tests {
+		if got := GetCookie(requestWithCookie(tt.value), cfg, "session"); got != tt.want {
+			t.Errorf("%s: GetCookie = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if got := GetCookie(httptest.NewRequest(http.MethodGet, "/", nil), cfg, "session"); got != "" {
+		t.Errorf("no cookie: GetCookie = %q", got)
+	}
+}
+
+// testRotated — набор, в котором ключ k0 из cfg подписывает: значение,
+// подписанное им, принимается и после ротации на k1.
+func testRotated(t *testing.T, cfg config.Config) *keyring.Ring {
+	key, ok := cfg.SessionKeys.Lookup("k0")
+	if !ok {
+		t.Fatal("k0 is not in the test ring")
+	}
+	ring, err := keyring.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+func TestCookieRoundTrip(t *testing.T) {
+	cfg := testConfig(t)
+
+	for _, value := range []string{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", "", "a.b.c"} {
+		w := httptest.NewRecorder()
+		AddCookie(cfg, "session", value, time.Now().Add(time.Hour), w)
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, item := range w.Result().Cookies() {
+			r.AddCookie(item)
+		}
+		if got := GetCookie(r, cfg, "session"); got != value {
+			t.Errorf("GetCookie after AddCookie(%q) = %q", value, got)
+		}
+	}
+}
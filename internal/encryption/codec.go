@@ -0,0 +1,91 @@
+package encryption
+
+import (
+	"crypto/hmac"
+	"diplom_ya/internal/keyring"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ошибки Decode; конкретная причина — в тексте обёрнутой ошибки.
+var (
+	ErrMalformed    = errors.New("token: malformed")
+	ErrBadSignature = errors.New("token: bad signature")
+	ErrExpired      = errors.New("token: expired")
+)
+
+// Формат токена версии 1:
+//
+//	v1.<kid>.<срок, unix>.<base64url(значение)>.<base64url(HMAC-SHA256)>
+//
+// Подпись считается ключом kid по всему, что до последней точки.
+// Токены без версии и без срока, выдававшиеся раньше, не принимаются: в них
+// лежал userID, а не идентификатор сессии, и сессией они не станут.
+const (
+	version1 = "v1"
+	maxToken = 4096
+)
+
+var b64 = base64.RawURLEncoding
+
+// Encode подписывает value активным ключом набора; токен действителен
+// до expires.
+func Encode(value string, expires time.Time, keys *keyring.Ring) string {
+	key := keys.Active()
+	payload := version1 + "." + key.ID + "." + strconv.FormatInt(expires.Unix(), 10) + "." + b64.EncodeToString([]byte(value))
+	return payload + "." + b64.EncodeToString(key.MAC([]byte(payload)))
+}
+
+// Decode проверяет подпись и срок токена и возвращает значение.
+// Ошибка — одна из ErrMalformed, ErrBadSignature, ErrExpired.
+func Decode(token string, now time.Time, keys *keyring.Ring) (string, error) {
+	if token == "" || len(token) > maxToken {
+		return "", fmt.Errorf("%w: length %d", ErrMalformed, len(token))
+	}
+
+	parts := strings.Split(token, ".")
+	if parts[0] != version1 {
+		return "", fmt.Errorf("%w: unknown format", ErrMalformed)
+	}
+	return decodeV1(parts, now, keys)
+}
+
+func decodeV1(parts []string, now time.Time, keys *keyring.Ring) (string, error) {
+	if len(parts) != 5 {
+		return "", fmt.Errorf("%w: %d parts", ErrMalformed, len(parts))
+	}
+	kid, rawExpires, rawValue, rawSig := parts[1], parts[2], parts[3], parts[4]
+
+	expires, err := strconv.ParseInt(rawExpires, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%w: expiry", ErrMalformed)
+	}
+	value, err := b64.DecodeString(rawValue)
+	if err != nil {
+		return "", fmt.Errorf("%w: value", ErrMalformed)
+	}
+	sig, err := b64.DecodeString(rawSig)
+	if err != nil {
+		return "", fmt.Errorf("%w: signature", ErrMalformed)
+	}
+
+	key, ok := keys.Lookup(kid)
+	if !ok {
+		return "", fmt.Errorf("%w: unknown key %q", ErrBadSignature, kid)
+	}
+	payload := strings.Join(parts[:4], ".")
+	if !hmac.Equal(sig, key.MAC([]byte(payload))) {
+		return "", ErrBadSignature
+	}
+
+	// срок проверяется после подписи: неподписанному сроку верить нельзя
+	if !now.Before(time.Unix(expires, 0)) {
+		return "", ErrExpired
+	}
+
+	return string(value), nil
+}
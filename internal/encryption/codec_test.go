@@ -0,0 +1,86 @@
+package encryption
+
+import (
+	"diplom_ya/internal/keyring"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testRing(t *testing.T, kids ...string) *keyring.Ring {
+	t.Helper()
+	var keys []keyring.Key
+	for _, kid := range kids {
+		keys = append(keys, keyring.Key{ID: kid, Secret: []byte(strings.Repeat(kid, 32))})
+	}
+	ring, err := keyring.New(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+func TestEncodeDecode(t *testing.T) {
+	keys := testRing(t, "k1")
+	now := time.Now()
+
+	for _, value := range []string{"", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "a.b.c", "юникод"} {
+		token := Encode(value, now.Add(time.Minute), keys)
+		got, err := Decode(token, now, keys)
+		if err != nil || got != value {
+			t.Errorf("Decode(Encode(%q)) = %q, %v", value, got, err)
+		}
+	}
+}
+
+func TestDecodeRotation(t *testing.T) {
+	now := time.Now()
+	token := Encode("value", now.Add(time.Minute), testRing(t, "old"))
+
+	// старый ключ вторым в наборе — токен ещё принимается
+	if _, err := Decode(token, now, testRing(t, "new", "old")); err != nil {
+		t.Errorf("rotated ring: %v", err)
+	}
+	// старый ключ удалён
+	if _, err := Decode(token, now, testRing(t, "new")); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("removed key: err = %v, want ErrBadSignature", err)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	keys := testRing(t, "k1")
+	now := time.Now()
+	valid := Encode("value", now.Add(time.Minute), keys)
+	parts := strings.Split(valid, ".")
+
+	key, _ := keys.Lookup("k1")
+	legacyValue := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	legacySig := hex.EncodeToString(key.MAC([]byte(legacyValue)))
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"empty", "", ErrMalformed},
+		{"too long", "v1." + strings.Repeat("a", maxToken), ErrMalformed},
+		{"expired", Encode("value", now.Add(-time.Second), keys), ErrExpired},
+		{"expires now", Encode("value", now, keys), ErrExpired},
+		{"tampered value", strings.Join([]string{parts[0], parts[1], parts[2], b64.EncodeToString([]byte("other")), parts[4]}, "."), ErrBadSignature},
+		{"extended expiry", strings.Join([]string{parts[0], parts[1], "99999999999", parts[3], parts[4]}, "."), ErrBadSignature},
+		{"unknown kid", strings.Join([]string{parts[0], "k2", parts[2], parts[3], parts[4]}, "."), ErrBadSignature},
+		{"extra part", valid + ".x", ErrMalformed},
+		{"bad expiry", strings.Join([]string{parts[0], parts[1], "soon", parts[3], parts[4]}, "."), ErrMalformed},
+		{"bad base64", strings.Join([]string{parts[0], parts[1], parts[2], "!!", parts[4]}, "."), ErrMalformed},
+		{"other version", "v2" + valid[2:], ErrMalformed},
+		{"legacy kid.hex.value", "k1." + legacySig + "." + legacyValue, ErrMalformed},
+		{"legacy hex+uuid", legacySig + legacyValue, ErrMalformed},
+	}
+	for _, tt := range tests {
+		if _, err := Decode(tt.token, now, keys); !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"diplom_ya/internal/keyring"
+	"fmt"
+	"strings"
+)
+
+// Seal шифрует секрет для хранения в базе (AES-256-GCM) ключом,
+// выведенным из активного ключа набора:
+//
+//	<kid>.<base64url(nonce|шифротекст)>
+//
+// Open расшифровывает ключом kid, поэтому смена ключей набора не
+// теряет записанное раньше.
+func Seal(plain []byte, keys *keyring.Ring) (string, error) {
+	key := keys.Active()
+	aead, err := sealCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plain, []byte(key.ID))
+	return key.ID + "." + b64.EncodeToString(sealed), nil
+}
+
+// Open расшифровывает значение Seal.
+func Open(sealed string, keys *keyring.Ring) ([]byte, error) {
+	parts := strings.SplitN(sealed, ".", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%w: sealed value", ErrMalformed)
+	}
+	kid, data := parts[0], parts[1]
+	key, ok := keys.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown kid %q", ErrBadSignature, kid)
+	}
+	raw, err := b64.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+
+	aead, err := sealCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: sealed value too short", ErrMalformed)
+	}
+	plain, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(kid))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	return plain, nil
+}
+
+// sealCipher — AES-GCM на ключе, выведенном из секрета HMAC, чтобы один
+// секрет не служил двум алгоритмам напрямую.
+func sealCipher(key keyring.Key) (cipher.AEAD, error) {
+	derived := sha256.Sum256(key.MAC([]byte("encryption.Seal")))
+	block, err := aes.NewCipher(derived[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"diplom_ya/internal/auth"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/problem"
+	"diplom_ya/internal/store"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+func adminUnlockLogin(cfg config.Config, storage store.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		body, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body could not be read")
+			return
+		}
+
+		type in struct {
+			Login string `json:"login"`
+			IP    string `json:"ip"`
+		}
+
+		valueIn := in{}
+
+		if err := json.Unmarshal(body, &valueIn); err != nil || (valueIn.Login == "" && valueIn.IP == "") {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body is not valid JSON or misses required fields")
+			return
+		}
+
+		if err := auth.UnlockLogin(r.Context(), storage, valueIn.Login, valueIn.IP); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(""))
+		fmt.Fprint(w)
+	}
+}
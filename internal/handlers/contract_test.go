@@ -0,0 +1,360 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"diplom_ya/internal/auth"
+	"diplom_ya/internal/openapi"
+	"diplom_ya/internal/totp"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// contract — проверка ответов по документу и учёт покрытых статусов.
+type contract struct {
+	*testServer
+	covered map[string]bool
+}
+
+// expect выполняет запрос, требует статус status и ответ по документу.
+func (c *contract) expect(client *http.Client, method string, path string, body string, header http.Header, status int) []byte {
+	c.t.Helper()
+
+	resp, data := c.do(client, method, path, body, header)
+	if resp.StatusCode != status {
+		c.t.Errorf("%s %s: status %d, want %d: %s", method, path, resp.StatusCode, status, data)
+		return data
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for _, mismatch := range openapi.CheckResponse(method, u.Path, resp.StatusCode, resp.Header, data) {
+		c.t.Errorf("%s %s -> %d: %s", method, path, resp.StatusCode, mismatch)
+	}
+	// у 204 нет тела, а значит, и его типа
+	if status == http.StatusNoContent {
+		if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+			c.t.Errorf("%s %s -> 204 with Content-Type %q", method, path, contentType)
+		}
+		if len(data) != 0 {
+			c.t.Errorf("%s %s -> 204 with body %q", method, path, data)
+		}
+	}
+	if status == http.StatusTooManyRequests && resp.Header.Get("Retry-After") == "" {
+		c.t.Errorf("%s %s -> 429 without Retry-After", method, path)
+	}
+
+	c.covered[method+" "+u.Path+" "+strconv.Itoa(status)] = true
+	return data
+}
+
+// lockOut повторяет неудачную попытку, пока защита от перебора не ответит 429.
+func (c *contract) lockOut(client *http.Client, method string, path string, body string, failure int) {
+	c.t.Helper()
+
+	for i := 0; i < c.cfg.LoginMaxFailures+1; i++ {
+		resp, data := c.do(client, method, path, body, nil)
+		switch resp.StatusCode {
+		case failure:
+			continue
+		case http.StatusTooManyRequests:
+			c.expect(client, method, path, body, nil, http.StatusTooManyRequests)
+			return
+		default:
+			c.t.Fatalf("%s %s: status %d while locking out: %s", method, path, resp.StatusCode, data)
+		}
+	}
+	c.t.Fatalf("%s %s: no 429 after %d failures", method, path, c.cfg.LoginMaxFailures+1)
+}
+
+// TestContract проходит все статусы всех операций документа OpenAPI
+// через роутер и сверяет ответы с документом.
+func TestContract(t *testing.T) {
+	c := &contract{testServer: newTestServer(t), covered: make(map[string]bool)}
+	ctx := context.Background()
+	plain := http.Header{"Content-Type": {"text/plain"}}
+
+	anonymous := newClient(t)
+	alice := newClient(t)
+	eve := newClient(t)
+	locked := newClient(t)
+	frank := newClient(t)
+	dave := newClient(t)
+	root := newClient(t)
+
+	c.expect(anonymous, http.MethodGet, "/api/openapi.json", "", nil, http.StatusOK)
+
+	// регистрация и вход
+	aliceID := c.register(alice, "alice", "Secret-pass-123")
+	c.register(eve, "eve", "Secret-pass-123")
+	c.register(locked, "locked", "Secret-pass-123")
+	c.register(frank, "frank", "Secret-pass-123")
+	c.register(dave, "dave", "Secret-pass-123")
+	rootID := c.register(root, "root", "Secret-pass-123")
+	if err := c.storage.GrantRole(ctx, rootID, auth.RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	c.expect(anonymous, http.MethodPost, "/api/user/register", `{"login": "carol", "password": "Secret-pass-123"}`, nil, http.StatusOK)
+	c.expect(anonymous, http.MethodPost, "/api/user/register", `{"login": "Alice", "password": "Secret-pass-123"}`, nil, http.StatusConflict)
+	c.expect(anonymous, http.MethodPost, "/api/user/register", `{"login": "al", "password": "short"}`, nil, http.StatusBadRequest)
+
+	c.expect(alice, http.MethodPost, "/api/user/login", `{"login": "alice", "password": "Secret-pass-123"}`, nil, http.StatusOK)
+	c.expect(anonymous, http.MethodPost, "/api/user/login", `{"login": "alice"}`, nil, http.StatusBadRequest)
+	c.expect(anonymous, http.MethodPost, "/api/user/login", `{"login": "alice", "password": "wrong-pass-1"}`, nil, http.StatusUnauthorized)
+	c.lockOut(anonymous, http.MethodPost, "/api/user/login", `{"login": "locked", "password": "wrong-pass-1"}`, http.StatusUnauthorized)
+
+	// refresh-токен из cookie
+	c.expect(alice, http.MethodPost, "/api/user/token/refresh", "", nil, http.StatusOK)
+	c.expect(anonymous, http.MethodPost, "/api/user/token/refresh", `{"refresh_token": 1}`, nil, http.StatusBadRequest)
+	c.expect(anonymous, http.MethodPost, "/api/user/token/refresh", `{"refresh_token": "unknown"}`, nil, http.StatusUnauthorized)
+
+	// сброс пароля
+	c.expect(anonymous, http.MethodPost, "/api/user/password/reset", `{"login": "carol"}`, nil, http.StatusAccepted)
+	c.expect(anonymous, http.MethodPost, "/api/user/password/reset", `{}`, nil, http.StatusBadRequest)
+	token := resetToken(t, c.cfg.NotifierFile, "carol")
+	c.expect(anonymous, http.MethodPost, "/api/user/password/reset/confirm", `{"token": "`+token+`", "new_password": "Other-pass-456"}`, nil, http.StatusOK)
+	c.expect(anonymous, http.MethodPost, "/api/user/password/reset/confirm", `{"token": "`+token+`", "new_password": "Other-pass-456"}`, nil, http.StatusBadRequest)
+
+	// заказы
+	c.expect(alice, http.MethodGet, "/api/user/orders", "", nil, http.StatusNoContent)
+	c.expect(alice, http.MethodPost, "/api/user/orders", "2377225624", plain, http.StatusAccepted)
+	c.expect(alice, http.MethodPost, "/api/user/orders", "2377225624", plain, http.StatusOK)
+	c.expect(eve, http.MethodPost, "/api/user/orders", "2377225624", plain, http.StatusConflict)
+	c.expect(alice, http.MethodPost, "/api/user/orders", "12345678901", plain, http.StatusUnprocessableEntity)
+	c.expect(alice, http.MethodPost, "/api/user/orders", "", plain, http.StatusBadRequest)
+	c.expect(anonymous, http.MethodPost, "/api/user/orders", "2377225624", plain, http.StatusUnauthorized)
+	c.expect(alice, http.MethodGet, "/api/user/orders", "", nil, http.StatusOK)
+	c.expect(alice, http.MethodGet, "/api/user/orders?limit=0", "", nil, http.StatusBadRequest)
+	c.expect(anonymous, http.MethodGet, "/api/user/orders", "", nil, http.StatusUnauthorized)
+
+	// баланс и списания
+	if _, err := c.storage.PostAdjustment(ctx, aliceID, 100*100, "contract test"); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(alice, http.MethodGet, "/api/user/balance", "", nil, http.StatusOK)
+	c.expect(anonymous, http.MethodGet, "/api/user/balance", "", nil, http.StatusUnauthorized)
+	c.expect(alice, http.MethodGet, "/api/user/balance/withdrawals", "", nil, http.StatusNoContent)
+	c.expect(alice, http.MethodPost, "/api/user/balance/withdraw", `{"order": "79927398713", "sum": 40.5}`, nil, http.StatusOK)
+	c.expect(alice, http.MethodPost, "/api/user/balance/withdraw", `{"order": "4561261212345467", "sum": 1000}`, nil, http.StatusPaymentRequired)
+	c.expect(alice, http.MethodPost, "/api/user/balance/withdraw", `{"order": "12345678901", "sum": 1}`, nil, http.StatusUnprocessableEntity)
+	c.expect(alice, http.MethodPost, "/api/user/balance/withdraw", `{"order": "4561261212345467"}`, nil, http.StatusBadRequest)
+	c.expect(anonymous, http.MethodPost, "/api/user/balance/withdraw", `{"order": "4561261212345467", "sum": 1}`, nil, http.StatusUnauthorized)
+	c.expect(alice, http.MethodGet, "/api/user/balance/withdrawals", "", nil, http.StatusOK)
+	c.expect(alice, http.MethodGet, "/api/user/balance/withdrawals?from=yesterday", "", nil, http.StatusBadRequest)
+	c.expect(anonymous, http.MethodGet, "/api/user/balance/withdrawals", "", nil, http.StatusUnauthorized)
+
+	// смена пароля
+	c.expect(alice, http.MethodPut, "/api/user/password", `{"current_password": "Secret-pass-123", "new_password": "Other-pass-456"}`, nil, http.StatusOK)
+	c.expect(alice, http.MethodPut, "/api/user/password", `{"new_password": "Other-pass-456"}`, nil, http.StatusBadRequest)
+	c.expect(alice, http.MethodPut, "/api/user/password", `{"current_password": "wrong-pass-1", "new_password": "Third-pass-789"}`, nil, http.StatusForbidden)
+	c.expect(anonymous, http.MethodPut, "/api/user/password", `{"current_password": "Other-pass-456", "new_password": "Third-pass-789"}`, nil, http.StatusUnauthorized)
+	c.expect(locked, http.MethodPut, "/api/user/password", `{"current_password": "Secret-pass-123", "new_password": "Third-pass-789"}`, nil, http.StatusTooManyRequests)
+
+	// второй фактор
+	c.expect(frank, http.MethodPost, "/api/user/totp/confirm", `{"code": "123456"}`, nil, http.StatusConflict)
+	var enrollment auth.Enrollment
+	if err := json.Unmarshal(c.expect(frank, http.MethodPost, "/api/user/totp", "", nil, http.StatusOK), &enrollment); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(anonymous, http.MethodPost, "/api/user/totp", "", nil, http.StatusUnauthorized)
+	c.expect(frank, http.MethodPost, "/api/user/totp/confirm", `{}`, nil, http.StatusBadRequest)
+	c.expect(frank, http.MethodPost, "/api/user/totp/confirm", `{"code": "`+wrongCode(t, enrollment.Secret)+`"}`, nil, http.StatusForbidden)
+	c.expect(anonymous, http.MethodPost, "/api/user/totp/confirm", `{"code": "123456"}`, nil, http.StatusUnauthorized)
+	var recovery struct {
+		Codes []string `json:"recovery_codes"`
+	}
+	if err := json.Unmarshal(c.expect(frank, http.MethodPost, "/api/user/totp/confirm", `{"code": "`+currentCode(t, enrollment.Secret)+`"}`, nil, http.StatusOK), &recovery); err != nil {
+		t.Fatal(err)
+	}
+	if len(recovery.Codes) < 2 {
+		t.Fatalf("got %d recovery codes", len(recovery.Codes))
+	}
+	c.expect(frank, http.MethodPost, "/api/user/totp", "", nil, http.StatusConflict)
+
+	// без ENCRYPTION_KEYS второй фактор выключен, коды восстановления действуют
+	cfg := c.cfg
+	cfg.EncryptionKeys = nil
+	keyless := &contract{testServer: c.withConfig(cfg), covered: c.covered}
+	keyless.expect(frank, http.MethodPost, "/api/user/totp", "", nil, http.StatusServiceUnavailable)
+	keyless.expect(frank, http.MethodPost, "/api/user/totp/confirm", `{"code": "123456"}`, nil, http.StatusServiceUnavailable)
+	keyless.expect(frank, http.MethodPost, "/api/user/totp/recovery-codes", `{"code": "`+recovery.Codes[1]+`"}`, nil, http.StatusServiceUnavailable)
+	keyless.expect(frank, http.MethodDelete, "/api/user/totp", `{"code": "`+currentCode(t, enrollment.Secret)+`"}`, nil, http.StatusServiceUnavailable)
+	keyless.expect(frank, http.MethodPost, "/api/user/login", `{"login": "frank", "password": "Secret-pass-123", "otp": "`+currentCode(t, enrollment.Secret)+`"}`, nil, http.StatusServiceUnavailable)
+	keyless.expect(frank, http.MethodPost, "/api/user/login", `{"login": "frank", "password": "Secret-pass-123", "otp": "`+recovery.Codes[1]+`"}`, nil, http.StatusOK)
+
+	c.expect(frank, http.MethodPost, "/api/user/totp/recovery-codes", `{}`, nil, http.StatusBadRequest)
+	c.expect(frank, http.MethodPost, "/api/user/totp/recovery-codes", `{"code": "aaaa-bbbb-cccc-dddd"}`, nil, http.StatusForbidden)
+	c.expect(anonymous, http.MethodPost, "/api/user/totp/recovery-codes", `{"code": "aaaa-bbbb-cccc-dddd"}`, nil, http.StatusUnauthorized)
+	if err := json.Unmarshal(c.expect(frank, http.MethodPost, "/api/user/totp/recovery-codes", `{"code": "`+recovery.Codes[0]+`"}`, nil, http.StatusOK), &recovery); err != nil {
+		t.Fatal(err)
+	}
+	c.expect(locked, http.MethodPost, "/api/user/totp/recovery-codes", `{"code": "aaaa-bbbb-cccc-dddd"}`, nil, http.StatusTooManyRequests)
+
+	c.expect(frank, http.MethodDelete, "/api/user/totp", `{}`, nil, http.StatusBadRequest)
+	c.expect(frank, http.MethodDelete, "/api/user/totp", `{"code": "aaaa-bbbb-cccc-dddd"}`, nil, http.StatusForbidden)
+	c.expect(anonymous, http.MethodDelete, "/api/user/totp", `{"code": "aaaa-bbbb-cccc-dddd"}`, nil, http.StatusUnauthorized)
+	c.expect(frank, http.MethodDelete, "/api/user/totp", `{"code": "`+recovery.Codes[0]+`"}`, nil, http.StatusOK)
+	c.expect(locked, http.MethodDelete, "/api/user/totp", `{"code": "aaaa-bbbb-cccc-dddd"}`, nil, http.StatusTooManyRequests)
+
+	// администрирование
+	c.expect(root, http.MethodPost, "/api/admin/login/unlock", `{"login": "Locked"}`, nil, http.StatusOK)
+	c.expect(root, http.MethodPost, "/api/admin/login/unlock", `{}`, nil, http.StatusBadRequest)
+	c.expect(alice, http.MethodPost, "/api/admin/login/unlock", `{"login": "locked"}`, nil, http.StatusForbidden)
+	c.expect(anonymous, http.MethodPost, "/api/admin/login/unlock", `{"login": "locked"}`, nil, http.StatusUnauthorized)
+	c.expect(locked, http.MethodPost, "/api/user/login", `{"login": "locked", "password": "Secret-pass-123"}`, nil, http.StatusOK)
+
+	// выход
+	c.expect(dave, http.MethodPost, "/api/user/logout", `{"refresh_token": 1}`, nil, http.StatusBadRequest)
+	c.expect(dave, http.MethodPost, "/api/user/logout", "", nil, http.StatusOK)
+	c.expect(dave, http.MethodPost, "/api/user/logout", "", nil, http.StatusUnauthorized)
+	c.expect(dave, http.MethodPost, "/api/user/login", `{"login": "dave", "password": "Secret-pass-123"}`, nil, http.StatusOK)
+	c.expect(dave, http.MethodPost, "/api/user/logout-all", "", nil, http.StatusOK)
+	c.expect(dave, http.MethodPost, "/api/user/logout-all", "", nil, http.StatusUnauthorized)
+
+	// отказ хранилища
+	c.faulty.setDown(true)
+	for _, item := range []struct {
+		client *http.Client
+		method string
+		path   string
+		body   string
+		header http.Header
+	}{
+		{anonymous, http.MethodPost, "/api/user/register", `{"login": "mallory", "password": "Secret-pass-123"}`, nil},
+		{anonymous, http.MethodPost, "/api/user/login", `{"login": "alice", "password": "Other-pass-456"}`, nil},
+		{anonymous, http.MethodPost, "/api/user/token/refresh", `{"refresh_token": "unknown"}`, nil},
+		{anonymous, http.MethodPost, "/api/user/password/reset", `{"login": "alice"}`, nil},
+		{anonymous, http.MethodPost, "/api/user/password/reset/confirm", `{"token": "unknown", "new_password": "Other-pass-456"}`, nil},
+		{alice, http.MethodPost, "/api/user/orders", "2377225624", plain},
+		{alice, http.MethodGet, "/api/user/orders", "", nil},
+		{alice, http.MethodGet, "/api/user/balance", "", nil},
+		{alice, http.MethodPost, "/api/user/balance/withdraw", `{"order": "4561261212345467", "sum": 1}`, nil},
+		{alice, http.MethodGet, "/api/user/balance/withdrawals", "", nil},
+		{alice, http.MethodPost, "/api/user/logout", "", nil},
+		{alice, http.MethodPost, "/api/user/logout-all", "", nil},
+		{alice, http.MethodPut, "/api/user/password", `{"current_password": "Other-pass-456", "new_password": "Third-pass-789"}`, nil},
+		{alice, http.MethodPost, "/api/user/totp", "", nil},
+		{alice, http.MethodDelete, "/api/user/totp", `{"code": "123456"}`, nil},
+		{alice, http.MethodPost, "/api/user/totp/confirm", `{"code": "123456"}`, nil},
+		{alice, http.MethodPost, "/api/user/totp/recovery-codes", `{"code": "123456"}`, nil},
+		{root, http.MethodPost, "/api/admin/login/unlock", `{"login": "locked"}`, nil},
+	} {
+		c.expect(item.client, item.method, item.path, item.body, item.header, http.StatusInternalServerError)
+	}
+	c.faulty.setDown(false)
+
+	for _, key := range documentedStatuses(t) {
+		if !c.covered[key] {
+			t.Errorf("%s: documented but not covered", key)
+		}
+	}
+}
+
+// Тело больше предела не дочитывается: 413 body_too_large.
+func TestRequestBodyLimit(t *testing.T) {
+	s := newTestServer(t)
+
+	body := `{"login": "bob", "password": "` + strings.Repeat("x", 2<<20) + `"}`
+	resp, data := s.do(nil, http.MethodPost, "/api/user/register", body, nil)
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || !strings.Contains(string(data), `"body_too_large"`) {
+		t.Errorf("oversized body: %d %s", resp.StatusCode, data)
+	}
+
+	s.register(nil, "bob", "Secret-pass-123")
+}
+
+// documentedStatuses — "МЕТОД путь статус" всех ответов документа.
+func documentedStatuses(t *testing.T) []string {
+	t.Helper()
+
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Responses map[string]json.RawMessage `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(openapi.Spec(), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	var out []string
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			for status := range op.Responses {
+				out = append(out, strings.ToUpper(method)+" "+path+" "+status)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// resetToken — последний токен сброса пароля, отправленный login.
+func resetToken(t *testing.T, path string, login string) string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var token string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var msg struct {
+			To   string `json:"to"`
+			Body string `json:"body"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.To != login {
+			continue
+		}
+		fields := strings.Fields(msg.Body)
+		for i, field := range fields {
+			if field == "пароля:" && i+1 < len(fields) {
+				token = fields[i+1]
+			}
+		}
+	}
+	if token == "" {
+		t.Fatalf("no reset token for %s in %s", login, path)
+	}
+	return token
+}
+
+func currentCode(t *testing.T, secret string) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// wrongCode — шесть цифр, которые не примутся ни на одном шаге в пределах
+// допуска часов.
+func wrongCode(t *testing.T, secret string) string {
+	t.Helper()
+
+	for i := 0; i < 1000000; i++ {
+		code := strconv.Itoa(1000000 + i)[1:]
+		if _, ok := totp.Validate(secret, code, time.Now(), 2); !ok {
+			return code
+		}
+	}
+	t.Fatal("no wrong code")
+	return ""
+}
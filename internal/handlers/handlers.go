@@ -3,45 +3,81 @@ package handlers
 import (
 	"diplom_ya/internal/auth"
 	"diplom_ya/internal/config"
-	"diplom_ya/internal/cookie"
 	"diplom_ya/internal/encryption"
+	"diplom_ya/internal/money"
+	"diplom_ya/internal/openapi"
+	"diplom_ya/internal/problem"
 	"diplom_ya/internal/store"
+	"diplom_ya/internal/validation"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
 )
 
-func NewRouter(cfg config.Config) *chi.Mux {
+func NewRouter(cfg config.Config, storage store.Storage) *chi.Mux {
 	r := chi.NewRouter()
 
+	r.Use(problem.RequestID)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusNotFound, problem.CodeNotFound, "no such path")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, http.StatusMethodNotAllowed, problem.CodeMethodNotAllowed, r.Method+" is not allowed here")
+	})
+
+	if cfg.OpenAPIValidate != "" && cfg.OpenAPIValidate != openapi.ModeOff {
+		r.Use(openapi.Validate(cfg.OpenAPIValidate))
+	}
+
+	r.Get("/api/openapi.json", openapi.ServeSpec) // описание API в OpenAPI 3.
+
+	r.Group(func(r chi.Router) {
+		r.Post("/api/user/register", userRegister(cfg, storage))                           // регистрация пользователя;
+		r.Post("/api/user/login", userLogin(cfg, storage))                                 // аутентификация пользователя;
+		r.Post("/api/user/token/refresh", tokenRefresh(cfg, storage))                      // продление сессии refresh-токеном;
+		r.Post("/api/user/password/reset", postPasswordReset(cfg, storage))                // запрос токена сброса пароля;
+		r.Post("/api/user/password/reset/confirm", postPasswordResetConfirm(cfg, storage)) // новый пароль по токену сброса;
+	})
+
 	r.Group(func(r chi.Router) {
-		r.Post("/api/user/register", userRegister(cfg)) // регистрация пользователя;
-		r.Post("/api/user/login", userLogin(cfg))       // аутентификация пользователя;
+		r.Use(auth.CheckAuthorized(cfg, storage))
+		r.Post("/api/user/orders", postOrder(cfg, storage))                      // загрузка пользователем номера заказа для расчёта;
+		r.Get("/api/user/orders", getOrders(cfg, storage))                       // получение списка загруженных пользователем номеров заказов, статусов их обработки и информации о начислениях;
+		r.Get("/api/user/balance", getBalance(cfg, storage))                     // получение текущего баланса счёта баллов лояльности пользователя;
+		r.Post("/api/user/balance/withdraw", postWithdraw(cfg, storage))         // запрос на списание баллов с накопительного счёта в счёт оплаты нового заказа;
+		r.Get("/api/user/balance/withdrawals", getWithdrawals(cfg, storage))     // получение информации о выводе средств с накопительного счёта пользователем.
+		r.Post("/api/user/logout", userLogout(cfg, storage))                     // завершение текущей сессии;
+		r.Post("/api/user/logout-all", userLogoutAll(cfg, storage))              // завершение всех сессий пользователя;
+		r.Put("/api/user/password", putPassword(cfg, storage))                   // смена пароля;
+		r.Post("/api/user/totp", postTOTP(cfg, storage))                         // выдача секрета второго фактора;
+		r.Post("/api/user/totp/confirm", postTOTPConfirm(cfg, storage))          // включение второго фактора;
+		r.Post("/api/user/totp/recovery-codes", postRecoveryCodes(cfg, storage)) // новые коды восстановления;
+		r.Delete("/api/user/totp", deleteTOTP(cfg, storage))                     // выключение второго фактора.
 	})
 
 	r.Group(func(r chi.Router) {
-		r.Use(auth.CheckAuthorized(cfg))
-		r.Post("/api/user/orders", postOrder(cfg))                  // загрузка пользователем номера заказа для расчёта;
-		r.Get("/api/user/orders", getOrders(cfg))                   // получение списка загруженных пользователем номеров заказов, статусов их обработки и информации о начислениях;
-		r.Get("/api/user/balance", getBalance(cfg))                 // получение текущего баланса счёта баллов лояльности пользователя;
-		r.Post("/api/user/balance/withdraw", postWithdraw(cfg))     // запрос на списание баллов с накопительного счёта в счёт оплаты нового заказа;
-		r.Get("/api/user/balance/withdrawals", getWithdrawals(cfg)) // получение информации о выводе средств с накопительного счёта пользователем.
+		r.Use(auth.CheckAuthorized(cfg, storage))
+		r.Use(auth.RequireRole(auth.RoleAdmin))
+		r.Post("/api/admin/login/unlock", adminUnlockLogin(cfg, storage)) // снятие блокировки входа.
 	})
 
 	return r
 }
 
-func userRegister(cfg config.Config) http.HandlerFunc {
+func userRegister(cfg config.Config, storage store.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		body, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body could not be read")
 			return
 		}
 
@@ -52,91 +88,120 @@ func userRegister(cfg config.Config) http.HandlerFunc {
 
 		valueIn := in{}
 
-		if err := json.Unmarshal(body, &valueIn); err != nil || valueIn.Login == "" || valueIn.Pass == "" {
-			http.Error(w, "register unmarshal error", http.StatusBadRequest)
+		if err := json.Unmarshal(body, &valueIn); err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body is not valid JSON or misses required fields")
 			return
 		}
 
-		use, err := auth.LoginUse(r.Context(), cfg, valueIn.Login)
-		if err != nil {
-			http.Error(w, "data base err", http.StatusInternalServerError)
+		login, err := validation.Register(cfg, valueIn.Login, valueIn.Pass)
+		var rules validation.Errors
+		if errors.As(err, &rules) {
+			problem.Validation(w, r, rules)
 			return
 		}
-		if use {
-			http.Error(w, "login already in use", http.StatusConflict)
+
+		userID, err := auth.NewUser(r.Context(), cfg, storage, login, valueIn.Pass)
+		if errors.Is(err, store.ErrDuplicate) {
+			problem.Write(w, r, http.StatusConflict, problem.CodeLoginTaken, "login already in use")
 			return
 		}
-
-		userID, err := auth.NewUser(r.Context(), cfg, valueIn.Login, valueIn.Pass)
 		if err != nil {
-			http.Error(w, "data base err", http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
-		cookie.AddCookie("userID", userID, w, r)
-
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Write([]byte(""))
-		fmt.Fprint(w)
+		refresh, err := auth.IssueRefreshToken(r.Context(), cfg, storage, userID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
 
+		signIn(w, r, cfg, storage, refresh)
 	}
 }
 
-func userLogin(cfg config.Config) http.HandlerFunc {
+func userLogin(cfg config.Config, storage store.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		body, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body could not be read")
 			return
 		}
 
 		type in struct {
 			Login string `json:"login"`
 			Pass  string `json:"password"`
+			OTP   string `json:"otp"`
 		}
 
 		valueIn := in{}
 
 		if err := json.Unmarshal(body, &valueIn); err != nil || valueIn.Login == "" || valueIn.Pass == "" {
-			http.Error(w, "login unmarshal error", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body is not valid JSON or misses required fields")
 			return
 		}
 
-		userID, err := auth.AuthorizeUser(r.Context(), cfg, valueIn.Login, valueIn.Pass)
-		if err != nil {
-			http.Error(w, "data base err", http.StatusInternalServerError)
+		// перебор паролей: пока вход закрыт, пароль не проверяется
+		userID, err := auth.AuthorizeUser(r.Context(), cfg, storage, valueIn.Login, valueIn.Pass, valueIn.OTP, auth.ClientIP(r))
+		var locked *auth.LockedError
+		switch {
+		case errors.As(err, &locked):
+			writeTooManyAttempts(w, r, locked)
+			return
+		case errors.Is(err, auth.ErrTOTPRequired):
+			// пароль верен, неудачей не считается
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeOTPRequired, "one-time code required in the otp field")
+			return
+		case errors.Is(err, auth.ErrTOTPInvalid):
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidOTP, "invalid one-time code")
+			return
+		case errors.Is(err, auth.ErrTOTPDisabled):
+			// пароль верен, неудачей не считается
+			problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeTOTPDisabled, "totp disabled, use a recovery code in the otp field")
+			return
+		case err != nil:
+			problem.Internal(w, r, err)
 			return
 		}
 		if userID == "" {
-			http.Error(w, "invalid username/password pair", http.StatusUnauthorized)
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidCredentials, "invalid username/password pair")
 			return
 		}
 
-		cookie.AddCookie("userID", userID, w, r)
+		refresh, err := auth.IssueRefreshToken(r.Context(), cfg, storage, userID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
 
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Write([]byte(""))
-		fmt.Fprint(w)
+		signIn(w, r, cfg, storage, refresh)
 	}
 }
 
-func getBalance(cfg config.Config) http.HandlerFunc {
+// writeTooManyAttempts отвечает 429 с Retry-After, пока защита от
+// перебора закрывает проверку пароля или кода.
+func writeTooManyAttempts(w http.ResponseWriter, r *http.Request, locked *auth.LockedError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+	problem.Write(w, r, http.StatusTooManyRequests, problem.CodeTooManyAttempts, "too many failed attempts, retry later")
+}
+
+func getBalance(cfg config.Config, storage store.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		fmt.Fprintln(os.Stdout, "getBalance")
 
 		type out struct {
-			Balanse  float32 `json:"current"`
-			SumSpent float32 `json:"withdrawn"`
+			Balanse  money.Amount `json:"current"`
+			SumSpent money.Amount `json:"withdrawn"`
 		}
 
-		userID := cookie.GetCookie(r, cfg, "userID")
+		userID, _ := auth.UserFromContext(r.Context())
 
-		balanse, spent, err := store.GetBalanseSpent(r.Context(), cfg, userID)
+		balanse, spent, err := storage.GetBalanseSpent(r.Context(), userID)
 		if err != nil {
-			http.Error(w, "data base error", http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
@@ -146,7 +211,7 @@ func getBalance(cfg config.Config) http.HandlerFunc {
 
 		result, err := json.Marshal(valueOut)
 		if err != nil {
-			http.Error(w, "marshal error", http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
@@ -157,7 +222,7 @@ func getBalance(cfg config.Config) http.HandlerFunc {
 	}
 }
 
-func postOrder(cfg config.Config) http.HandlerFunc {
+func postOrder(cfg config.Config, storage store.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		// 200 — номер заказа уже был загружен этим пользователем;
@@ -173,23 +238,31 @@ func postOrder(cfg config.Config) http.HandlerFunc {
 		body, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body could not be read")
 			return
 		}
 
 		order := string(body)
 		if order == "" {
-			http.Error(w, "order not found", http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "order number is required")
 			return
 		}
 
 		if !encryption.CheckOrder(order) {
-			http.Error(w, "invalid format order", http.StatusUnprocessableEntity)
+			problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidOrder, "order number fails the Luhn check")
 			return
 		}
 
-		userID := cookie.GetCookie(r, cfg, "userID")
-		httpStatus := store.AddOrder(r.Context(), cfg, order, userID)
+		userID, _ := auth.UserFromContext(r.Context())
+		httpStatus := storage.AddOrder(r.Context(), order, userID)
+		switch httpStatus {
+		case http.StatusConflict:
+			problem.Write(w, r, httpStatus, problem.CodeOrderTaken, "order number was uploaded by another user")
+			return
+		case http.StatusInternalServerError:
+			problem.Internal(w, r, fmt.Errorf("add order %s: data base error", order))
+			return
+		}
 
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(httpStatus)
@@ -198,29 +271,44 @@ func postOrder(cfg config.Config) http.HandlerFunc {
 	}
 }
 
-func getOrders(cfg config.Config) http.HandlerFunc {
+func getOrders(cfg config.Config, storage store.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		fmt.Fprintln(os.Stdout, "getOrders")
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 
-		userID := cookie.GetCookie(r, cfg, "userID")
+		userID, _ := auth.UserFromContext(r.Context())
 
-		valueOut, err := store.GetAccum(r.Context(), cfg, userID)
+		statuses := []string{cfg.New, cfg.Processing, cfg.Invalid, cfg.Processed}
+		filter, limit, err := listFilter(cfg, r, statuses)
+		if rules, ok := err.(validation.Errors); ok {
+			problem.Validation(w, r, rules)
+			return
+		}
+
+		valueOut, err := storage.GetAccum(r.Context(), userID, filter)
 		fmt.Fprintln(os.Stdout, err)
 		if err != nil {
-			http.Error(w, "getOrders/ data base error", http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
 		if len(valueOut) == 0 {
-			http.Error(w, "getOrders/ no orders", http.StatusNoContent)
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
+		if len(valueOut) > limit {
+			valueOut = valueOut[:limit]
+			last := valueOut[limit-1]
+			setNextPage(w, r, store.Cursor{Date: last.Date, Order: last.Order})
+		}
+
+		for i := range valueOut {
+			valueOut[i].Date = displayTime(cfg, valueOut[i].Date)
+		}
 		result, err := json.Marshal(valueOut)
 		if err != nil {
-			http.Error(w, "getOrders/ marshal error", http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
@@ -231,7 +319,7 @@ func getOrders(cfg config.Config) http.HandlerFunc {
 	}
 }
 
-func postWithdraw(cfg config.Config) http.HandlerFunc {
+func postWithdraw(cfg config.Config, storage store.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		fmt.Fprintln(os.Stdout, "postWithdraw")
@@ -241,30 +329,48 @@ func postWithdraw(cfg config.Config) http.HandlerFunc {
 		if err != nil {
 			fmt.Fprintln(os.Stdout, "postWithdraw/ err:")
 			fmt.Fprintln(os.Stdout, err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body could not be read")
 			return
 		}
 		fmt.Fprintln(os.Stdout, "postWithdraw/ body: "+string(body))
 
 		type in struct {
-			Order string  `json:"order"`
-			Sum   float32 `json:"sum"`
+			Order string       `json:"order"`
+			Sum   money.Amount `json:"sum"`
 		}
 
 		valueIn := in{}
 
-		if err := json.Unmarshal(body, &valueIn); err != nil || valueIn.Order == "" || valueIn.Sum == 0 {
-			http.Error(w, "unmarshal error", http.StatusBadRequest)
+		if err := json.Unmarshal(body, &valueIn); err != nil || valueIn.Order == "" || valueIn.Sum <= 0 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body is not valid JSON or misses required fields")
 			return
 		}
 
 		if !encryption.CheckOrder(valueIn.Order) {
-			http.Error(w, "invalid format order", http.StatusUnprocessableEntity)
+			problem.Write(w, r, http.StatusUnprocessableEntity, problem.CodeInvalidOrder, "order number fails the Luhn check")
+			return
+		}
+
+		// повтор запроса с тем же ключом не спишет баллы второй раз
+		idempotencyKey := r.Header.Get("Idempotency-Key")
+		if len(idempotencyKey) > 255 {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "Idempotency-Key is too long")
 			return
 		}
 
-		userID := cookie.GetCookie(r, cfg, "userID")
-		httpStatus := store.WriteWithdraw(r.Context(), cfg, valueIn.Order, valueIn.Sum, userID)
+		userID, _ := auth.UserFromContext(r.Context())
+		httpStatus := storage.WriteWithdraw(r.Context(), valueIn.Order, valueIn.Sum, userID, idempotencyKey)
+		switch httpStatus {
+		case http.StatusPaymentRequired:
+			problem.Write(w, r, httpStatus, problem.CodeInsufficientFunds, "not enough points on the balance")
+			return
+		case http.StatusUnprocessableEntity:
+			problem.Write(w, r, httpStatus, problem.CodeIdempotencyConflict, "Idempotency-Key was already used with another order or sum")
+			return
+		case http.StatusInternalServerError:
+			problem.Internal(w, r, fmt.Errorf("withdraw for order %s: data base error", valueIn.Order))
+			return
+		}
 
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(httpStatus)
@@ -274,27 +380,43 @@ func postWithdraw(cfg config.Config) http.HandlerFunc {
 	}
 }
 
-func getWithdrawals(cfg config.Config) http.HandlerFunc {
+func getWithdrawals(cfg config.Config, storage store.Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
 		fmt.Fprintln(os.Stdout, "getWithdrawals")
 
-		userID := cookie.GetCookie(r, cfg, "userID")
+		userID, _ := auth.UserFromContext(r.Context())
+
+		statuses := []string{store.WithdrawalPending, store.WithdrawalCompleted, store.WithdrawalReversed}
+		filter, limit, err := listFilter(cfg, r, statuses)
+		if rules, ok := err.(validation.Errors); ok {
+			problem.Validation(w, r, rules)
+			return
+		}
 
-		valueOut, err := store.GetWithdrawals(r.Context(), cfg, userID)
+		valueOut, err := storage.GetWithdrawals(r.Context(), userID, filter)
 		if err != nil {
-			http.Error(w, "data base error", http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
 		if len(valueOut) == 0 {
-			http.Error(w, "no orders", http.StatusNoContent)
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
+		if len(valueOut) > limit {
+			valueOut = valueOut[:limit]
+			last := valueOut[limit-1]
+			setNextPage(w, r, store.Cursor{Date: last.Date, Order: last.Order})
+		}
+
+		for i := range valueOut {
+			valueOut[i].Date = displayTime(cfg, valueOut[i].Date)
+		}
 		result, err := json.Marshal(valueOut)
 		if err != nil {
-			http.Error(w, "marshal error", http.StatusInternalServerError)
+			problem.Internal(w, r, err)
 			return
 		}
 
@@ -0,0 +1,225 @@
+package handlers_test
+
+import (
+	"context"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/handlers"
+	"diplom_ya/internal/keyring"
+	"diplom_ya/internal/openapi"
+	"diplom_ya/internal/store"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/caarlos0/env"
+)
+
+// testConfig — настройки по умолчанию из тегов envDefault с тестовыми
+// ключами, дешёвым хешем паролей и проверкой запросов по документу.
+func testConfig(t *testing.T) config.Config {
+	t.Helper()
+
+	var cfg config.Config
+	if err := env.Parse(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	ring, err := keyring.New(keyring.Key{ID: "test", Secret: []byte(strings.Repeat("k", 32))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.SessionKeys, cfg.MACKeys, cfg.EncryptionKeys = ring, ring, ring
+
+	cfg.Storage = "memory"
+	cfg.PasswordHasher = "bcrypt"
+	cfg.BcryptCost = 4
+	cfg.Notifier = "file"
+	cfg.NotifierFile = filepath.Join(t.TempDir(), "notify.jsonl")
+	// все тестовые клиенты приходят с одного адреса
+	cfg.LoginIPMaxFailures = 1000
+	cfg.OpenAPIValidate = openapi.ModeRequest
+	cfg.DisplayLocation = time.UTC
+	cfg.OrdersStatus = config.OrdersStatus{
+		New:        "NEW",
+		Processing: "PROCESSING",
+		Invalid:    "INVALID",
+		Processed:  "PROCESSED",
+		Registered: "REGISTERED ",
+	}
+	return cfg
+}
+
+// testServer — роутер на хранилище в памяти и клиент с cookie.
+type testServer struct {
+	t       *testing.T
+	cfg     config.Config
+	storage *store.Memory
+	faulty  *faultyStorage
+	server  *httptest.Server
+	client  *http.Client
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	cfg := testConfig(t)
+	storage := store.NewMemory(cfg)
+	faulty := &faultyStorage{Storage: storage}
+	server := httptest.NewServer(handlers.NewRouter(cfg, faulty))
+	t.Cleanup(server.Close)
+
+	return &testServer{
+		t:       t,
+		cfg:     cfg,
+		storage: storage,
+		faulty:  faulty,
+		server:  server,
+		client:  newClient(t),
+	}
+}
+
+// withConfig — второй роутер с настройками cfg над тем же хранилищем.
+func (s *testServer) withConfig(cfg config.Config) *testServer {
+	s.t.Helper()
+
+	server := httptest.NewServer(handlers.NewRouter(cfg, s.faulty))
+	s.t.Cleanup(server.Close)
+
+	other := *s
+	other.cfg = cfg
+	other.server = server
+	return &other
+}
+
+var errStorageDown = errors.New("storage is down")
+
+// faultyStorage — хранилище, которое по setDown(true) отказывает в
+// первых обращениях каждого хендлера: ошибки хранилища должны давать 500.
+type faultyStorage struct {
+	store.Storage
+	down int32
+}
+
+func (f *faultyStorage) setDown(down bool) {
+	var value int32
+	if down {
+		value = 1
+	}
+	atomic.StoreInt32(&f.down, value)
+}
+
+func (f *faultyStorage) isDown() bool {
+	return atomic.LoadInt32(&f.down) == 1
+}
+
+func (f *faultyStorage) WriteNewUser(ctx context.Context, login string, hash string) (string, error) {
+	if f.isDown() {
+		return "", errStorageDown
+	}
+	return f.Storage.WriteNewUser(ctx, login, hash)
+}
+
+func (f *faultyStorage) ReadUser(ctx context.Context, login string) (string, string, error) {
+	if f.isDown() {
+		return "", "", errStorageDown
+	}
+	return f.Storage.ReadUser(ctx, login)
+}
+
+func (f *faultyStorage) GetPasswordReset(ctx context.Context, hash string) (string, error) {
+	if f.isDown() {
+		return "", errStorageDown
+	}
+	return f.Storage.GetPasswordReset(ctx, hash)
+}
+
+func (f *faultyStorage) ReserveLoginAttempt(ctx context.Context, scope string, key string, now time.Time, since time.Time, lockFor func(failures int) time.Duration) (time.Time, error) {
+	if f.isDown() {
+		return time.Time{}, errStorageDown
+	}
+	return f.Storage.ReserveLoginAttempt(ctx, scope, key, now, since, lockFor)
+}
+
+func (f *faultyStorage) GetSession(ctx context.Context, sessionID string) (store.Session, error) {
+	if f.isDown() {
+		return store.Session{}, errStorageDown
+	}
+	return f.Storage.GetSession(ctx, sessionID)
+}
+
+func (f *faultyStorage) RotateRefreshToken(ctx context.Context, hash string, next store.RefreshToken) (store.RefreshToken, error) {
+	if f.isDown() {
+		return store.RefreshToken{}, errStorageDown
+	}
+	return f.Storage.RotateRefreshToken(ctx, hash, next)
+}
+
+func newClient(t *testing.T) *http.Client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{Jar: jar}
+}
+
+// do выполняет запрос клиентом client (nil — клиент сервера) и
+// возвращает ответ с прочитанным телом.
+func (s *testServer) do(client *http.Client, method string, path string, body string, header http.Header) (*http.Response, []byte) {
+	s.t.Helper()
+
+	if client == nil {
+		client = s.client
+	}
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, s.server.URL+path, reader)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return resp, data
+}
+
+// register регистрирует пользователя клиентом client (nil — клиент
+// сервера), клиент входит под ним; возвращает идентификатор пользователя.
+func (s *testServer) register(client *http.Client, login string, password string) string {
+	s.t.Helper()
+
+	resp, body := s.do(client, http.MethodPost, "/api/user/register",
+		`{"login": "`+login+`", "password": "`+password+`"}`, nil)
+	if resp.StatusCode != http.StatusOK {
+		s.t.Fatalf("register %s: %d %s", login, resp.StatusCode, body)
+	}
+
+	userID, _, err := s.storage.ReadUser(context.Background(), login)
+	if err != nil || userID == "" {
+		s.t.Fatalf("register %s: user not stored: %v", login, err)
+	}
+	return userID
+}
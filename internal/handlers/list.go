@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/store"
+	"diplom_ya/internal/validation"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Параметры списков:
+//
+//	limit  — записей на странице, по умолчанию cfg.PageLimit, не больше cfg.PageMaxLimit;
+//	cursor — из заголовка X-Next-Cursor (или ссылки Link) предыдущей страницы;
+//	status — статусы через запятую, регистр не важен;
+//	from, to — даты RFC 3339 или ГГГГ-ММ-ДД в DISPLAY_TIMEZONE; to-дата без времени
+//	           включает весь день.
+//
+// Ошибки в параметрах возвращаются ответом 400 в формате validation.Errors.
+
+// listFilter читает параметры списка; limit — размер страницы, в
+// фильтре — на одну запись больше, чтобы узнать, есть ли следующая.
+func listFilter(cfg config.Config, r *http.Request, statuses []string) (store.ListFilter, int, error) {
+	query := r.URL.Query()
+
+	var (
+		filter store.ListFilter
+		errs   validation.Errors
+	)
+
+	limit := cfg.PageLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		switch {
+		case err != nil || n < 1:
+			errs = append(errs, validation.Rule{Field: "limit", Rule: "integer", Message: "limit must be a positive integer"})
+		case n > cfg.PageMaxLimit:
+			errs = append(errs, validation.Rule{Field: "limit", Rule: "max", Message: fmt.Sprintf("limit must be at most %d", cfg.PageMaxLimit)})
+		default:
+			limit = n
+		}
+	}
+	filter.Limit = limit + 1
+
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, ok := decodeCursor(raw)
+		if !ok {
+			errs = append(errs, validation.Rule{Field: "cursor", Rule: "format", Message: "cursor is malformed"})
+		}
+		filter.After = cursor
+	}
+
+	if raw := query.Get("status"); raw != "" {
+		for _, status := range strings.Split(raw, ",") {
+			known, ok := lookupStatus(statuses, strings.TrimSpace(status))
+			if !ok {
+				errs = append(errs, validation.Rule{Field: "status", Rule: "enum", Message: "status must be one of " + strings.Join(statuses, ", ")})
+				break
+			}
+			filter.Status = append(filter.Status, known)
+		}
+	}
+
+	var ok bool
+	if raw := query.Get("from"); raw != "" {
+		if filter.From, ok = parseListDate(cfg, raw, false); !ok {
+			errs = append(errs, validation.Rule{Field: "from", Rule: "format", Message: "from must be an RFC 3339 time or YYYY-MM-DD date"})
+		}
+	}
+	if raw := query.Get("to"); raw != "" {
+		if filter.To, ok = parseListDate(cfg, raw, true); !ok {
+			errs = append(errs, validation.Rule{Field: "to", Rule: "format", Message: "to must be an RFC 3339 time or YYYY-MM-DD date"})
+		}
+	}
+
+	if len(errs) > 0 {
+		return store.ListFilter{}, 0, errs
+	}
+	return filter, limit, nil
+}
+
+// parseListDate разбирает RFC 3339 или дату в часовом поясе
+// cfg.DisplayLocation; end — граница «до»: дата без времени даёт начало
+// следующего дня.
+func parseListDate(cfg config.Config, raw string, end bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, true
+	}
+	t, err := time.ParseInLocation("2006-01-02", raw, displayLocation(cfg))
+	if err != nil {
+		return time.Time{}, false
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, true
+}
+
+// setNextPage отдаёт курсор следующей страницы в X-Next-Cursor и ссылкой
+// Link с теми же параметрами запроса.
+func setNextPage(w http.ResponseWriter, r *http.Request, last store.Cursor) {
+	cursor := encodeCursor(last)
+
+	query := r.URL.Query()
+	query.Set("cursor", cursor)
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+
+	w.Header().Set("X-Next-Cursor", cursor)
+	w.Header().Set("Link", "<"+next.String()+`>; rel="next"`)
+}
+
+// курсор — base64url("<unix-наносекунды>.<номер заказа>"); подписывать
+// незачем: выборка всё равно ограничена пользователем
+func encodeCursor(c store.Cursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.Date.UnixNano(), 10) + "." + c.Order))
+}
+
+func decodeCursor(raw string) (store.Cursor, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return store.Cursor{}, false
+	}
+	parts := strings.SplitN(string(data), ".", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return store.Cursor{}, false
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return store.Cursor{}, false
+	}
+	return store.Cursor{Date: time.Unix(0, nanos).UTC(), Order: parts[1]}, true
+}
+
+// lookupStatus ищет статус без учёта регистра и возвращает его запись из list.
+func lookupStatus(list []string, value string) (string, bool) {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return item, true
+		}
+	}
+	return "", false
+}
+
+// displayTime — время для ответа: в часовом поясе cfg.DisplayLocation,
+// с точностью до секунды, как в спецификации (RFC 3339).
+func displayTime(cfg config.Config, t time.Time) time.Time {
+	return t.In(displayLocation(cfg)).Truncate(time.Second)
+}
+
+func displayLocation(cfg config.Config) *time.Location {
+	if cfg.DisplayLocation == nil {
+		return time.UTC
+	}
+	return cfg.DisplayLocation
+}
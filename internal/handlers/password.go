@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"diplom_ya/internal/auth"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/notify"
+	"diplom_ya/internal/problem"
+	"diplom_ya/internal/store"
+	"diplom_ya/internal/validation"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// putPassword меняет пароль. Все сессии и refresh-токены пользователя
+// отзываются, вызывающему выдаются новые.
+func putPassword(cfg config.Config, storage store.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		body, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body could not be read")
+			return
+		}
+
+		type in struct {
+			Current string `json:"current_password"`
+			New     string `json:"new_password"`
+		}
+
+		valueIn := in{}
+
+		if err := json.Unmarshal(body, &valueIn); err != nil || valueIn.Current == "" {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body is not valid JSON or misses required fields")
+			return
+		}
+
+		userID, _ := auth.UserFromContext(r.Context())
+
+		err = auth.ChangePassword(r.Context(), cfg, storage, userID, valueIn.Current, valueIn.New, auth.ClientIP(r))
+		var rules validation.Errors
+		var locked *auth.LockedError
+		switch {
+		case errors.As(err, &locked):
+			writeTooManyAttempts(w, r, locked)
+			return
+		case errors.Is(err, auth.ErrWrongPassword):
+			problem.Write(w, r, http.StatusForbidden, problem.CodeWrongPassword, "wrong current password")
+			return
+		case errors.As(err, &rules):
+			problem.Validation(w, r, rules)
+			return
+		case err != nil:
+			problem.Internal(w, r, err)
+			return
+		}
+
+		refresh, err := auth.IssueRefreshToken(r.Context(), cfg, storage, userID)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		signIn(w, r, cfg, storage, refresh)
+	}
+}
+
+// postPasswordReset отправляет токен сброса пароля. Ответ 202 не зависит
+// от того, есть ли такой пользователь.
+func postPasswordReset(cfg config.Config, storage store.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		body, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body could not be read")
+			return
+		}
+
+		type in struct {
+			Login string `json:"login"`
+		}
+
+		valueIn := in{}
+
+		if err := json.Unmarshal(body, &valueIn); err != nil || valueIn.Login == "" {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body is not valid JSON or misses required fields")
+			return
+		}
+
+		notifier, err := notify.New(cfg)
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		if err := auth.RequestPasswordReset(r.Context(), cfg, storage, notifier, valueIn.Login); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(""))
+		fmt.Fprint(w)
+	}
+}
+
+// postPasswordResetConfirm ставит новый пароль по токену сброса.
+func postPasswordResetConfirm(cfg config.Config, storage store.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		body, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body could not be read")
+			return
+		}
+
+		type in struct {
+			Token string `json:"token"`
+			New   string `json:"new_password"`
+		}
+
+		valueIn := in{}
+
+		if err := json.Unmarshal(body, &valueIn); err != nil || valueIn.Token == "" {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body is not valid JSON or misses required fields")
+			return
+		}
+
+		err = auth.ResetPassword(r.Context(), cfg, storage, valueIn.Token, valueIn.New)
+		var rules validation.Errors
+		switch {
+		case errors.Is(err, auth.ErrResetInvalid):
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeInvalidResetToken, "invalid or expired reset token")
+			return
+		case errors.As(err, &rules):
+			problem.Validation(w, r, rules)
+			return
+		case err != nil:
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(""))
+		fmt.Fprint(w)
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"diplom_ya/internal/auth"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/problem"
+	"diplom_ya/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// signIn открывает сессию и отдаёт refresh-токен в cookie; с настроенным
+// JWT отвечает также токенами в теле для клиентов без cookie.
+func signIn(w http.ResponseWriter, r *http.Request, cfg config.Config, storage store.Storage, refresh auth.Refresh) {
+
+	if err := auth.StartSession(r.Context(), cfg, storage, w, refresh); err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+	auth.SetRefreshCookie(cfg, w, refresh)
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if cfg.JWTKeys == nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(""))
+		fmt.Fprint(w)
+		return
+	}
+
+	type out struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int64  `json:"expires_in"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	token, expires, err := auth.IssueAccessToken(r.Context(), cfg, storage, refresh.UserID)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	result, err := json.Marshal(out{
+		AccessToken:  token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(time.Until(expires).Seconds()),
+		RefreshToken: refresh.Token,
+	})
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(result)
+	fmt.Fprint(w)
+}
+
+// readRefreshToken — refresh-токен из тела {"refresh_token": "..."}
+// или, если тело пустое, из cookie.
+func readRefreshToken(r *http.Request) (string, error) {
+
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		return "", err
+	}
+
+	type in struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	valueIn := in{}
+
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &valueIn); err != nil {
+			return "", err
+		}
+	}
+
+	return auth.RefreshTokenFromRequest(r, valueIn.RefreshToken), nil
+}
+
+func tokenRefresh(cfg config.Config, storage store.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		raw, err := readRefreshToken(r)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body is not valid JSON or misses required fields")
+			return
+		}
+
+		refresh, err := auth.RotateRefreshToken(r.Context(), cfg, storage, raw)
+		if errors.Is(err, auth.ErrRefreshInvalid) {
+			problem.Write(w, r, http.StatusUnauthorized, problem.CodeInvalidRefreshToken, "invalid refresh token")
+			return
+		}
+		if err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		signIn(w, r, cfg, storage, refresh)
+	}
+}
+
+func userLogout(cfg config.Config, storage store.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		raw, err := readRefreshToken(r)
+		if err != nil {
+			problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body is not valid JSON or misses required fields")
+			return
+		}
+
+		if err := auth.EndSession(r.Context(), cfg, storage, w, raw); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(""))
+		fmt.Fprint(w)
+	}
+}
+
+func userLogoutAll(cfg config.Config, storage store.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		userID, _ := auth.UserFromContext(r.Context())
+
+		if err := auth.EndAllSessions(r.Context(), cfg, storage, w, userID); err != nil {
+			problem.Internal(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(""))
+		fmt.Fprint(w)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// Обмен refresh-токена закрывает прежнюю сессию, а повтор уже обменянного
+// токена отзывает сессии семейства и access-токены пользователя.
+func TestRefreshReuse(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+
+	userID := s.register(nil, "bob", "Secret-pass-123")
+
+	u, err := url.Parse(s.server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// клиент со cookie первой сессии и первым refresh-токеном
+	earlier := newClient(t)
+	earlier.Jar.SetCookies(u, s.client.Jar.Cookies(u))
+
+	if resp, body := s.do(nil, http.MethodPost, "/api/user/token/refresh", "", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("refresh: %d %s", resp.StatusCode, body)
+	}
+	if resp, body := s.do(nil, http.MethodGet, "/api/user/balance", "", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("balance with the new session: %d %s", resp.StatusCode, body)
+	}
+	if resp, _ := s.do(earlier, http.MethodGet, "/api/user/balance", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("balance with the rotated session: %d, want 401", resp.StatusCode)
+	}
+
+	generation, err := s.storage.GetTokenGeneration(ctx, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, body := s.do(earlier, http.MethodPost, "/api/user/token/refresh", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("replayed refresh: %d %s, want 401", resp.StatusCode, body)
+	}
+	if resp, _ := s.do(earlier, http.MethodGet, "/api/user/balance", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("balance with the earlier session after replay: %d, want 401", resp.StatusCode)
+	}
+	if resp, _ := s.do(nil, http.MethodGet, "/api/user/balance", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("balance with the family's session after replay: %d, want 401", resp.StatusCode)
+	}
+	if resp, _ := s.do(nil, http.MethodPost, "/api/user/token/refresh", "", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("refresh with the revoked family: %d, want 401", resp.StatusCode)
+	}
+
+	if after, err := s.storage.GetTokenGeneration(ctx, userID); err != nil {
+		t.Fatal(err)
+	} else if after <= generation {
+		t.Errorf("token generation %d after replay, want above %d", after, generation)
+	}
+}
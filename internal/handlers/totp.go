@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"diplom_ya/internal/auth"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/problem"
+	"diplom_ya/internal/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// postTOTP выдаёт секрет второго фактора и otpauth-ссылку.
+func postTOTP(cfg config.Config, storage store.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		userID, _ := auth.UserFromContext(r.Context())
+
+		enrollment, err := auth.BeginTOTP(r.Context(), cfg, storage, userID)
+		if !writeTOTPError(w, r, err) {
+			return
+		}
+
+		writeJSON(w, r, enrollment)
+	}
+}
+
+// postTOTPConfirm включает второй фактор по коду из приложения и
+// возвращает коды восстановления.
+func postTOTPConfirm(cfg config.Config, storage store.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		code, ok := readTOTPCode(w, r)
+		if !ok {
+			return
+		}
+
+		userID, _ := auth.UserFromContext(r.Context())
+
+		codes, err := auth.ConfirmTOTP(r.Context(), cfg, storage, userID, code)
+		if !writeTOTPError(w, r, err) {
+			return
+		}
+
+		writeRecoveryCodes(w, r, codes)
+	}
+}
+
+// postRecoveryCodes выдаёт новые коды восстановления взамен старых.
+func postRecoveryCodes(cfg config.Config, storage store.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		code, ok := readTOTPCode(w, r)
+		if !ok {
+			return
+		}
+
+		userID, _ := auth.UserFromContext(r.Context())
+
+		codes, err := auth.RegenerateRecoveryCodes(r.Context(), cfg, storage, userID, code, auth.ClientIP(r))
+		if !writeTOTPError(w, r, err) {
+			return
+		}
+
+		writeRecoveryCodes(w, r, codes)
+	}
+}
+
+// deleteTOTP выключает второй фактор.
+func deleteTOTP(cfg config.Config, storage store.Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		code, ok := readTOTPCode(w, r)
+		if !ok {
+			return
+		}
+
+		userID, _ := auth.UserFromContext(r.Context())
+
+		err := auth.DisableTOTP(r.Context(), cfg, storage, userID, code, auth.ClientIP(r))
+		if !writeTOTPError(w, r, err) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(""))
+		fmt.Fprint(w)
+	}
+}
+
+// readTOTPCode читает {"code": "..."}; при ошибке ответ уже записан.
+func readTOTPCode(w http.ResponseWriter, r *http.Request) (string, bool) {
+	body, err := io.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body could not be read")
+		return "", false
+	}
+
+	type in struct {
+		Code string `json:"code"`
+	}
+
+	valueIn := in{}
+
+	if err := json.Unmarshal(body, &valueIn); err != nil || valueIn.Code == "" {
+		problem.Write(w, r, http.StatusBadRequest, problem.CodeBadRequest, "request body is not valid JSON or misses required fields")
+		return "", false
+	}
+	return valueIn.Code, true
+}
+
+// writeTOTPError отвечает на ошибку второго фактора; true — ошибки нет.
+func writeTOTPError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var locked *auth.LockedError
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &locked):
+		writeTooManyAttempts(w, r, locked)
+	case errors.Is(err, auth.ErrTOTPInvalid):
+		problem.Write(w, r, http.StatusForbidden, problem.CodeInvalidOTP, "invalid one-time code")
+	case errors.Is(err, auth.ErrTOTPNotStarted):
+		problem.Write(w, r, http.StatusConflict, problem.CodeTOTPNotStarted, "totp enrollment not started")
+	case errors.Is(err, auth.ErrTOTPEnabled):
+		problem.Write(w, r, http.StatusConflict, problem.CodeTOTPEnabled, "totp already enabled")
+	case errors.Is(err, auth.ErrTOTPDisabled):
+		problem.Write(w, r, http.StatusServiceUnavailable, problem.CodeTOTPDisabled, "totp disabled")
+	default:
+		problem.Internal(w, r, err)
+	}
+	return false
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, r *http.Request, codes []string) {
+	type out struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	writeJSON(w, r, out{RecoveryCodes: codes})
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, value interface{}) {
+	result, err := json.Marshal(value)
+	if err != nil {
+		problem.Internal(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(result)
+	fmt.Fprint(w)
+}
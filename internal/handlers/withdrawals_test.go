@@ -0,0 +1,177 @@
+package handlers_test
+
+import (
+	"context"
+	"diplom_ya/internal/money"
+	"diplom_ya/internal/store"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+)
+
+// История списаний по спецификации: поля order, sum, processed_at и статус
+// completed, после сторнирования — reversed без учёта в withdrawn.
+func TestWithdrawals(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+
+	userID := s.register(nil, "bob", "Secret-pass-123")
+	if _, err := s.storage.PostAdjustment(ctx, userID, 1000*100, "test balance"); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp, body := s.do(nil, http.MethodGet, "/api/user/balance/withdrawals", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("withdrawals before withdraw: %d %s, want 204", resp.StatusCode, body)
+	}
+
+	before := time.Now().Add(-time.Second)
+	for _, in := range []string{
+		`{"order": "2377225624", "sum": 751}`,
+		`{"order": "12345678903", "sum": 100.5}`,
+	} {
+		if resp, body := s.do(nil, http.MethodPost, "/api/user/balance/withdraw", in, nil); resp.StatusCode != http.StatusOK {
+			t.Fatalf("withdraw %s: %d %s", in, resp.StatusCode, body)
+		}
+	}
+
+	checkBalance(t, s, 148.5, 851.5)
+
+	items := getWithdrawals(t, s, "")
+	if len(items) != 2 {
+		t.Fatalf("got %d withdrawals, want 2", len(items))
+	}
+	for _, item := range items {
+		var fields []string
+		for name := range item {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		if want := []string{"order", "processed_at", "status", "sum"}; !equalStrings(fields, want) {
+			t.Errorf("withdrawal fields %v, want %v", fields, want)
+		}
+
+		processed, err := time.Parse(time.RFC3339, decodeString(t, item["processed_at"]))
+		if err != nil {
+			t.Errorf("processed_at: %v", err)
+		} else if processed.Before(before) || processed.After(time.Now().Add(time.Second)) {
+			t.Errorf("processed_at %v is not the withdrawal time", processed)
+		}
+		if status := decodeString(t, item["status"]); status != store.WithdrawalCompleted {
+			t.Errorf("status %q, want %q", status, store.WithdrawalCompleted)
+		}
+	}
+
+	first := items[0]
+	if order := decodeString(t, first["order"]); order != "2377225624" {
+		t.Errorf("first order %q, want 2377225624", order)
+	}
+	var sum money.Amount
+	if err := json.Unmarshal(first["sum"], &sum); err != nil || sum != 751*100 {
+		t.Errorf("first sum %s, want 751", first["sum"])
+	}
+
+	// сторнирование первого списания
+	entryID := withdrawalEntry(t, s, userID, "2377225624")
+	if _, err := s.storage.ReverseEntry(ctx, entryID, "test reversal"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBalance(t, s, 899.5, 100.5)
+
+	statuses := make(map[string]string)
+	for _, item := range getWithdrawals(t, s, "") {
+		statuses[decodeString(t, item["order"])] = decodeString(t, item["status"])
+	}
+	want := map[string]string{"2377225624": store.WithdrawalReversed, "12345678903": store.WithdrawalCompleted}
+	for order, status := range want {
+		if statuses[order] != status {
+			t.Errorf("order %s status %q, want %q", order, statuses[order], status)
+		}
+	}
+
+	reversed := getWithdrawals(t, s, "?status=reversed")
+	if len(reversed) != 1 || decodeString(t, reversed[0]["order"]) != "2377225624" {
+		t.Errorf("status=reversed filter: got %d items", len(reversed))
+	}
+
+	if _, err := s.storage.ReverseEntry(ctx, entryID, "again"); err == nil {
+		t.Error("second reversal succeeded")
+	}
+}
+
+func checkBalance(t *testing.T, s *testServer, current float64, withdrawn float64) {
+	t.Helper()
+
+	resp, body := s.do(nil, http.MethodGet, "/api/user/balance", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("balance: %d %s", resp.StatusCode, body)
+	}
+	var out struct {
+		Current   float64 `json:"current"`
+		Withdrawn float64 `json:"withdrawn"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Current != current || out.Withdrawn != withdrawn {
+		t.Errorf("balance current=%v withdrawn=%v, want %v and %v", out.Current, out.Withdrawn, current, withdrawn)
+	}
+}
+
+func getWithdrawals(t *testing.T, s *testServer, query string) []map[string]json.RawMessage {
+	t.Helper()
+
+	resp, body := s.do(nil, http.MethodGet, "/api/user/balance/withdrawals"+query, "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("withdrawals: %d %s", resp.StatusCode, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("withdrawals Content-Type %q", ct)
+	}
+	var items []map[string]json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+// withdrawalEntry — запись журнала со списанием по заказу order.
+func withdrawalEntry(t *testing.T, s *testServer, userID string, order string) string {
+	t.Helper()
+
+	postings, err := s.storage.GetLedger(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range postings {
+		if item.Kind == store.KindWithdrawal && item.Order == order {
+			return item.EntryID
+		}
+	}
+	t.Fatalf("no ledger entry for withdrawal %s", order)
+	return ""
+}
+
+func decodeString(t *testing.T, raw json.RawMessage) string {
+	t.Helper()
+
+	var out string
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Errorf("%s is not a string: %v", raw, err)
+	}
+	return out
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+// Package keyring — наборы секретных ключей HMAC, раздельные по назначению.
+//
+// В наборе первый ключ активный — им подписывают, проверяют любым ключом
+// набора по его идентификатору (kid). Ключ меняют без разлогинивания
+// пользователей: новый ключ ставят первым, старый оставляют в наборе,
+// пока не истекут подписанные им значения, затем удаляют.
+//
+// Наборы задаются переменными окружения вида
+//
+//	SESSION_KEYS="2024-02:<секрет>,2024-01:<секрет>"
+//
+// или файлом KEYS_FILE:
+//
+//	{"session": [{"kid": "2024-02", "secret": "<секрет>"}], "mac": [...], "encryption": [...]}
+//
+// Переменная окружения важнее файла. Секрет — строка не короче 32 байт
+// (например, вывод openssl rand -hex 32).
+package keyring
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Назначения ключей.
+const (
+	PurposeSession    = "session"    // подпись cookie сессии
+	PurposeMAC        = "mac"        // прочие HMAC
+	PurposeEncryption = "encryption" // шифрование секретов в базе
+)
+
+const minSecret = 32
+
+// Key — ключ набора.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// MAC — HMAC-SHA256 от data.
+func (k Key) MAC(data []byte) []byte {
+	h := hmac.New(sha256.New, k.Secret)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Random — ключ kid со случайным секретом; живёт, пока работает процесс.
+func Random(kid string) (Key, error) {
+	secret := make([]byte, minSecret)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, fmt.Errorf("keyring: %w", err)
+	}
+	return Key{ID: kid, Secret: []byte(hex.EncodeToString(secret))}, nil
+}
+
+// Ring — набор ключей одного назначения.
+type Ring struct {
+	keys []Key
+}
+
+// New собирает набор; первый ключ — активный.
+func New(keys ...Key) (*Ring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring: no keys")
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if !validID(key.ID) {
+			return nil, fmt.Errorf("keyring: invalid kid %q", key.ID)
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("keyring: duplicate kid %q", key.ID)
+		}
+		seen[key.ID] = true
+	}
+	return &Ring{keys: keys}, nil
+}
+
+// Active — ключ для подписи.
+func (r *Ring) Active() Key {
+	return r.keys[0]
+}
+
+// Lookup ищет ключ по kid.
+func (r *Ring) Lookup(kid string) (Key, bool) {
+	for _, key := range r.keys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// Keys — все ключи набора, активный первым.
+func (r *Ring) Keys() []Key {
+	return append([]Key(nil), r.keys...)
+}
+
+// With возвращает набор с ключом key в конце — только для проверки.
+func (r *Ring) With(key Key) (*Ring, error) {
+	return New(append(r.Keys(), key)...)
+}
+
+// kid попадает в подписанные значения, поэтому без разделителей
+func validID(kid string) bool {
+	if kid == "" || len(kid) > 64 {
+		return false
+	}
+	for _, c := range kid {
+		ok := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse разбирает набор "kid:секрет,kid:секрет".
+func Parse(spec string) (*Ring, error) {
+	var keys []Key
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		i := strings.IndexByte(item, ':')
+		if i < 0 {
+			return nil, errors.New("keyring: key must be kid:secret")
+		}
+		key, err := newKey(item[:i], item[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return New(keys...)
+}
+
+func newKey(kid string, secret string) (Key, error) {
+	if len(secret) < minSecret {
+		return Key{}, fmt.Errorf("keyring: key %q: secret shorter than %d bytes", kid, minSecret)
+	}
+	return Key{ID: kid, Secret: []byte(secret)}, nil
+}
+
+type fileKey struct {
+	Kid    string `json:"kid"`
+	Secret string `json:"secret"`
+}
+
+// Load собирает наборы по назначениям из файла path (если задан)
+// и переменных окружения env (назначение → значение). Назначение без ключей
+// в результат не попадает.
+func Load(path string, env map[string]string) (map[string]*Ring, error) {
+	out := make(map[string]*Ring)
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("keyring: %w", err)
+		}
+		var file map[string][]fileKey
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("keyring: %s: %w", path, err)
+		}
+		for purpose, items := range file {
+			var keys []Key
+			for _, item := range items {
+				key, err := newKey(item.Kid, item.Secret)
+				if err != nil {
+					return nil, err
+				}
+				keys = append(keys, key)
+			}
+			ring, err := New(keys...)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", purpose, err)
+			}
+			out[purpose] = ring
+		}
+	}
+
+	for purpose, spec := range env {
+		if spec == "" {
+			continue
+		}
+		ring, err := Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", purpose, err)
+		}
+		out[purpose] = ring
+	}
+
+	return out, nil
+}
@@ -0,0 +1,225 @@
+// Package migrate применяет версионированные миграции схемы PostgreSQL.
+//
+// Миграции — пары файлов NNNN_name.up.sql / NNNN_name.down.sql. Применённые
+// версии записываются в таблицу schema_version. На время работы берётся
+// advisory lock, поэтому несколько реплик могут стартовать одновременно:
+// миграции применит первая, остальные дождутся её и ничего не сделают.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// lockKey — ключ pg_advisory_lock для миграций гофермарта.
+const lockKey = 7_305_412_118
+
+var fileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+var ErrNoDown = errors.New("migrate: down migration is missing")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// Load читает миграции из каталога dir файловой системы fsys.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, err
+		}
+		text, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d has two names: %s, %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(text)
+		} else {
+			m.Down = string(text)
+		}
+	}
+
+	var out []Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrate: version %d has no up migration", m.Version)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+
+	return out, nil
+}
+
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Latest — номер последней известной миграции.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version возвращает текущую версию схемы.
+func (m *Migrator) Version(ctx context.Context) (version int, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn) error {
+		version, err = currentVersion(ctx, conn)
+		return err
+	})
+	return
+}
+
+// Up применяет все ещё не применённые миграции.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down откатывает steps последних применённых миграций.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		current, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		var applied []int
+		for _, mig := range m.migrations {
+			if mig.Version <= current {
+				applied = append(applied, mig.Version)
+			}
+		}
+		target := 0
+		if steps < len(applied) {
+			target = applied[len(applied)-steps-1]
+		}
+		return m.migrate(ctx, conn, current, target)
+	})
+}
+
+// To приводит схему к версии target, применяя или откатывая миграции.
+func (m *Migrator) To(ctx context.Context, target int) error {
+	return m.locked(ctx, func(conn *sql.Conn) error {
+		current, err := currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		return m.migrate(ctx, conn, current, target)
+	})
+}
+
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, current int, target int) error {
+	if target > current {
+		for _, mig := range m.migrations {
+			if mig.Version <= current || mig.Version > target {
+				continue
+			}
+			if err := apply(ctx, conn, mig.Up, `INSERT INTO schema_version ("version", "name") VALUES ($1, $2)`, mig.Version, mig.Name); err != nil {
+				return fmt.Errorf("migrate: up %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+		}
+		return nil
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if mig.Version > current || mig.Version <= target {
+			continue
+		}
+		if mig.Down == "" {
+			return fmt.Errorf("%w: %04d_%s", ErrNoDown, mig.Version, mig.Name)
+		}
+		if err := apply(ctx, conn, mig.Down, `DELETE FROM schema_version WHERE "version" = $1`, mig.Version); err != nil {
+			return fmt.Errorf("migrate: down %04d_%s: %w", mig.Version, mig.Name, err)
+		}
+	}
+	return nil
+}
+
+// locked выполняет fn на выделенном соединении под advisory lock.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	if err := createVersionTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func apply(ctx context.Context, conn *sql.Conn, text string, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, text); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func createVersionTable(ctx context.Context, conn *sql.Conn) error {
+	textCreate := `CREATE TABLE IF NOT EXISTS schema_version(
+		"version" INTEGER PRIMARY KEY,
+		"name" TEXT NOT NULL,
+		"applied_at" TIMESTAMPTZ NOT NULL DEFAULT now()
+		 );`
+	_, err := conn.ExecContext(ctx, textCreate)
+	return err
+}
+
+func currentVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	err := conn.QueryRowContext(ctx, `SELECT COALESCE(max("version"), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
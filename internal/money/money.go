@@ -0,0 +1,186 @@
+// Package money — точные суммы баллов лояльности.
+//
+// Сумма хранится целым числом сотых долей балла (1 балл = 1 рубль,
+// сотая — копейка), поэтому сложение, вычитание и сравнение точны.
+//
+// Правила разбора:
+//   - суммы от клиентов и из командной строки (Parse, JSON) — только
+//     десятичная запись вида 42, -0.5, 729.98: не больше двух знаков после
+//     точки, без порядка, дробей и префиксов системы счисления. Лишние
+//     знаки — ошибка, а не округление: 0.005 не превращается в 0.01;
+//   - значения от доверенных источников (ParseRounded: ответы системы
+//     начислений, значения из БД) — десятичная запись с любым числом знаков
+//     и порядком, округляется до сотых «половина от нуля»: 0.005 → 0.01,
+//     -0.005 → -0.01, 0.0049 → 0.00;
+//   - FLOAT из старых столбцов сначала переводится в кратчайшее десятичное
+//     представление (729.97998 хранится как 729.98 → 729.98);
+//   - на выходе сумма печатается точно, без лишних нулей: 500.5, 42, 0.01.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Amount — сумма в сотых долях балла.
+type Amount int64
+
+const (
+	scale  = 100
+	maxLen = 64
+	maxExp = 32
+)
+
+var ErrInvalid = errors.New("money: invalid amount")
+
+var (
+	plainAmount   = regexp.MustCompile(`^-?[0-9]+(\.[0-9]{1,2})?$`)
+	decimalAmount = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+)
+
+// Parse разбирает сумму от клиента: "729.98", "42", "-0.5".
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > maxLen || !plainAmount.MatchString(s) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	return fromRat(r)
+}
+
+// ParseRounded разбирает десятичную запись суммы от доверенного источника
+// ("729.975", "1e2") с округлением до сотых.
+func ParseRounded(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if len(s) > maxLen || !decimalAmount.MatchString(s) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	// большой порядок заставил бы big.Rat строить огромные числа
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		exp, err := strconv.Atoi(s[i+1:])
+		if err != nil || exp > maxExp || exp < -maxExp {
+			return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalid, s)
+	}
+	return fromRat(r)
+}
+
+// FromFloat переводит число с плавающей точкой через его кратчайшее
+// десятичное представление.
+func FromFloat(f float64) (Amount, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, ErrInvalid
+	}
+	return ParseRounded(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+func fromRat(r *big.Rat) (Amount, error) {
+	scaled := new(big.Rat).Mul(r, big.NewRat(scale, 1))
+
+	// округление половины от нуля
+	num := new(big.Int).Abs(scaled.Num())
+	den := scaled.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if scaled.Sign() < 0 {
+		q.Neg(q)
+	}
+
+	if !q.IsInt64() {
+		return 0, fmt.Errorf("%w: %s out of range", ErrInvalid, r.FloatString(2))
+	}
+	return Amount(q.Int64()), nil
+}
+
+// String печатает сумму с двумя знаками после точки: "729.98", "-0.50".
+func (a Amount) String() string {
+	sign := ""
+	v := uint64(a)
+	if a < 0 {
+		sign = "-"
+		v = uint64(-a)
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/scale, v%scale)
+}
+
+// Float64 — приближённое значение, только для отображения.
+func (a Amount) Float64() float64 {
+	return float64(a) / scale
+}
+
+// compact — String без незначащих нулей: "500.5", "42".
+func (a Amount) compact() string {
+	s := strings.TrimRight(a.String(), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.compact()), nil
+}
+
+// UnmarshalJSON принимает число или строку с числом в записи Parse.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Scan читает NUMERIC (строкой) и, для старых данных, FLOAT и целые.
+// Значения из БД доверенные и округляются, как в ParseRounded.
+func (a *Amount) Scan(src interface{}) error {
+	var (
+		v   Amount
+		err error
+	)
+	switch src := src.(type) {
+	case nil:
+		v = 0
+	case string:
+		v, err = ParseRounded(src)
+	case []byte:
+		v, err = ParseRounded(string(src))
+	case int64:
+		v, err = ParseRounded(strconv.FormatInt(src, 10))
+	case float64:
+		v, err = FromFloat(src)
+	case float32:
+		v, err = ParseRounded(strconv.FormatFloat(float64(src), 'f', -1, 32))
+	default:
+		err = fmt.Errorf("%w: cannot scan %T", ErrInvalid, src)
+	}
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// Value передаёт сумму в NUMERIC строкой без потери точности.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
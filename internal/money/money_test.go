@@ -0,0 +1,187 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+	}{
+		{"0", 0},
+		{"42", 4200},
+		{"-0.5", -50},
+		{"729.98", 72998},
+		{" 7.25 ", 725},
+		{"0.01", 1},
+		{"007.10", 710},
+		{"92233720368547758.07", math.MaxInt64},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, in := range []string{
+		"", " ", "-", "+1", ".5", "5.", "1.", "0.005", "1.234", "1/3", "0x10", "0b1", "0o7",
+		"1e2", "1E-2", "NaN", "Inf", "-Inf", "1,5", "1 000", "١٢", "--1", "1-",
+		"92233720368547758.08", strings.Repeat("9", 70),
+	} {
+		if got, err := Parse(in); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) = %d, %v; want ErrInvalid", in, got, err)
+		}
+	}
+}
+
+func TestParseRounded(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+	}{
+		{"0.005", 1},
+		{"-0.005", -1},
+		{"0.0049", 0},
+		{"729.975", 72998},
+		{"1e2", 10000},
+		{"1.5E-1", 15},
+		{"42", 4200},
+	}
+	for _, tt := range tests {
+		got, err := ParseRounded(tt.in)
+		if err != nil {
+			t.Errorf("ParseRounded(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRounded(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"1/3", "0x10", "1e99", ".5", "NaN"} {
+		if _, err := ParseRounded(in); !errors.Is(err, ErrInvalid) {
+			t.Errorf("ParseRounded(%q): err = %v, want ErrInvalid", in, err)
+		}
+	}
+}
+
+// Свойство: String и Parse взаимно обратны на всём диапазоне Amount.
+func TestStringParseRoundTrip(t *testing.T) {
+	roundTrip := func(a Amount) bool {
+		if a == math.MinInt64 {
+			// -MinInt64 не представимо, такую сумму не выразить строкой Parse
+			return true
+		}
+		got, err := Parse(a.String())
+		return err == nil && got == a
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Свойство: сумма переживает JSON без изменений.
+func TestJSONRoundTrip(t *testing.T) {
+	roundTrip := func(a Amount) bool {
+		if a == math.MinInt64 {
+			return true
+		}
+		data, err := json.Marshal(a)
+		if err != nil {
+			return false
+		}
+		var got Amount
+		return json.Unmarshal(data, &got) == nil && got == a
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Свойство: третий знак после точки — всегда ошибка, а не округление.
+func TestParseRejectsSubCent(t *testing.T) {
+	subCent := func(a Amount, digit uint8) bool {
+		if a == math.MinInt64 {
+			return true
+		}
+		_, err := Parse(a.String() + string(rune('0'+digit%10)))
+		return errors.Is(err, ErrInvalid)
+	}
+	if err := quick.Check(subCent, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Свойство: Parse и ParseRounded совпадают на суммах без долей копейки.
+func TestParseRoundedAgreesWithParse(t *testing.T) {
+	agree := func(a Amount) bool {
+		if a == math.MinInt64 {
+			return true
+		}
+		strict, err1 := Parse(a.String())
+		rounded, err2 := ParseRounded(a.String())
+		return err1 == nil && err2 == nil && strict == rounded
+	}
+	if err := quick.Check(agree, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// Свойство: сумма, переведённая во float64 и обратно, не меняется, пока
+// float64 хранит её точно.
+func TestFromFloatRoundTrip(t *testing.T) {
+	const maxExact = 1 << 50
+	roundTrip := func(a Amount) bool {
+		a %= maxExact
+		got, err := FromFloat(a.Float64())
+		return err == nil && got == a
+	}
+	if err := quick.Check(roundTrip, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	var a Amount
+	if err := json.Unmarshal([]byte(`"12.5"`), &a); err != nil || a != 1250 {
+		t.Errorf(`Unmarshal("12.5") = %d, %v`, a, err)
+	}
+	for _, in := range []string{`0.005`, `1e2`, `"1/3"`, `"0x10"`, `true`} {
+		if err := json.Unmarshal([]byte(in), &a); err == nil {
+			t.Errorf("Unmarshal(%s): want error", in)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Amount
+	}{
+		{"729.98", 72998},
+		{[]byte("-0.50"), -50},
+		{int64(7), 700},
+		{729.98, 72998},
+		{float32(0.1), 10},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		var got Amount
+		if err := got.Scan(tt.src); err != nil || got != tt.want {
+			t.Errorf("Scan(%v) = %d, %v; want %d", tt.src, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// Package notify — доставка сообщений пользователям (токены сброса пароля).
+//
+// Почты у гофермарта пока нет, поэтому сообщения пишутся в лог сервиса
+// (NOTIFIER=log) или дописываются строками JSON в файл NOTIFIER_FILE
+// (NOTIFIER=file) — оттуда их забирают тесты или внешний отправщик.
+package notify
+
+import (
+	"context"
+	"diplom_ya/internal/config"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Message — сообщение пользователю; To — логин получателя.
+type Message struct {
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	Date    time.Time `json:"date"`
+}
+
+// Notifier доставляет сообщения.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// New возвращает доставку, выбранную cfg.Notifier.
+func New(cfg config.Config) (Notifier, error) {
+	switch cfg.Notifier {
+	case "log":
+		return Log{}, nil
+	case "file":
+		if cfg.NotifierFile == "" {
+			return nil, fmt.Errorf("notify: NOTIFIER_FILE is required for file notifier")
+		}
+		return File{Path: cfg.NotifierFile}, nil
+	default:
+		return nil, fmt.Errorf("notify: unknown notifier %q", cfg.Notifier)
+	}
+}
+
+// Log пишет сообщения в лог сервиса.
+type Log struct{}
+
+func (Log) Notify(ctx context.Context, msg Message) error {
+	log.Printf("notify: to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// File дописывает сообщения в файл по строке JSON на сообщение.
+type File struct {
+	Path string
+}
+
+// запись строк из разных запросов не должна перемешиваться
+var fileMu sync.Mutex
+
+func (f File) Notify(ctx context.Context, msg Message) error {
+	if msg.Date.IsZero() {
+		msg.Date = time.Now()
+	}
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
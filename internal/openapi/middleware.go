@@ -0,0 +1,262 @@
+package openapi
+
+import (
+	"bytes"
+	"diplom_ya/internal/problem"
+	"diplom_ya/internal/validation"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Режимы проверки (OPENAPI_VALIDATE).
+const (
+	ModeOff     = "off"     // без проверки
+	ModeRequest = "request" // запросы не по документу отклоняются
+	ModeAll     = "all"     // ещё и ответы не по документу пишутся в лог
+)
+
+// сколько тела ответа держать для проверки
+const maxCheckedBody = 1 << 20
+
+// больше тела запроса не читается
+const maxRequestBody = 1 << 20
+
+// Validate проверяет запросы к описанным в документе операциям: параметры,
+// тип и схему тела. Нарушения — ответ 400 validation_failed со списком
+// errors, неописанный Content-Type тела — 415, тело больше maxRequestBody — 413
+// (см. internal/problem). В режиме ModeAll ответы тоже
+// сверяются с документом, расхождения пишутся в лог: ответ клиенту уже
+// отправлен. Запросы к неописанным путям пропускаются как есть.
+func Validate(mode string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			op := doc.operation(r.Method, r.URL.Path)
+			if op == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			errs, status := doc.checkRequest(op, w, r)
+			switch status {
+			case http.StatusUnsupportedMediaType:
+				problem.Write(w, r, status, problem.CodeUnsupportedMedia, "unsupported Content-Type "+r.Header.Get("Content-Type"))
+				return
+			case http.StatusRequestEntityTooLarge:
+				problem.Write(w, r, status, problem.CodeBodyTooLarge, fmt.Sprintf("request body is larger than %d bytes", maxRequestBody))
+				return
+			}
+			if len(errs) > 0 {
+				problem.Validation(w, r, errs)
+				return
+			}
+
+			if mode != ModeAll {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			for _, mismatch := range doc.checkResponse(op, rec.status, rec.Header(), rec.body.Bytes()) {
+				log.Printf("openapi: %s %s -> %d: %s", r.Method, r.URL.Path, rec.status, mismatch)
+			}
+		})
+	}
+}
+
+// checkRequest проверяет параметры и тело; тело читается не больше
+// maxRequestBody и после чтения возвращается в r.Body для хендлера.
+func (d *document) checkRequest(op *operation, w http.ResponseWriter, r *http.Request) (validation.Errors, int) {
+	var errs validation.Errors
+
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		p = d.parameter(p)
+		if p == nil {
+			continue
+		}
+		var (
+			raw     string
+			present bool
+		)
+		switch p.In {
+		case "query":
+			raw, present = query.Get(p.Name), query.Has(p.Name)
+		case "header":
+			raw = r.Header.Get(p.Name)
+			present = raw != ""
+		default:
+			continue
+		}
+		if !present {
+			if p.Required {
+				errs = append(errs, validation.Rule{Field: p.Name, Rule: "required", Message: p.Name + " is required"})
+			}
+			continue
+		}
+		errs = append(errs, d.validate(p.Schema, parseParam(d.schema(p.Schema), raw), p.Name)...)
+	}
+
+	if op.RequestBody == nil {
+		return errs, 0
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil && len(body) == maxRequestBody {
+		// MaxBytesReader отдал всё, что разрешено, и оборвал чтение
+		return errs, http.StatusRequestEntityTooLarge
+	}
+	if err != nil {
+		return append(errs, validation.Rule{Field: "body", Rule: "read", Message: "request body could not be read"}), 0
+	}
+	if len(body) == 0 {
+		if op.RequestBody.Required {
+			errs = append(errs, validation.Rule{Field: "body", Rule: "required", Message: "request body is required"})
+		}
+		return errs, 0
+	}
+
+	ctype := mediaTypeOf(r.Header.Get("Content-Type"))
+	if ctype == "" {
+		// клиенты, не приславшие Content-Type, проверяются по первому описанному
+		ctype = firstMediaType(op.RequestBody.Content)
+	}
+	media, ok := op.RequestBody.Content[ctype]
+	if !ok {
+		return errs, http.StatusUnsupportedMediaType
+	}
+
+	value, err := decodeBody(ctype, body)
+	if err != nil {
+		return append(errs, validation.Rule{Field: "body", Rule: "json", Message: "request body is not valid JSON"}), 0
+	}
+	return append(errs, d.validate(media.Schema, value, "")...), 0
+}
+
+// CheckResponse сверяет ответ на запрос method к пути path (без query) с
+// документом и возвращает расхождения; ответы неописанных операций не
+// проверяются. Нужен тестам: на стенде то же делает Validate в ModeAll.
+func CheckResponse(method string, path string, status int, header http.Header, body []byte) []string {
+	op := doc.operation(method, path)
+	if op == nil {
+		return nil
+	}
+	return doc.checkResponse(op, status, header, body)
+}
+
+// checkResponse возвращает расхождения ответа с документом.
+func (d *document) checkResponse(op *operation, status int, header http.Header, body []byte) []string {
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return []string{"status is not documented"}
+	}
+	resp = d.response(resp)
+	if resp == nil || len(body) == 0 || len(resp.Content) == 0 {
+		return nil
+	}
+
+	ctype := mediaTypeOf(header.Get("Content-Type"))
+	media, ok := resp.Content[ctype]
+	if !ok {
+		return []string{fmt.Sprintf("Content-Type %q is not documented", ctype)}
+	}
+	if len(body) >= maxCheckedBody {
+		return nil
+	}
+
+	value, err := decodeBody(ctype, body)
+	if err != nil {
+		return []string{"body is not valid JSON"}
+	}
+	var problems []string
+	for _, rule := range d.validate(media.Schema, value, "") {
+		problems = append(problems, rule.Field+": "+rule.Message)
+	}
+	return problems
+}
+
+// parseParam приводит строку параметра к типу схемы; не приводится —
+// остаётся строкой, и validate сообщит о типе.
+func parseParam(s *Schema, raw string) interface{} {
+	if s == nil {
+		return raw
+	}
+	switch s.Type {
+	case "integer", "number":
+		if num, err := strconv.ParseFloat(raw, 64); err == nil {
+			return num
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	}
+	return raw
+}
+
+func decodeBody(ctype string, body []byte) (interface{}, error) {
+	if ctype != "application/json" && !strings.HasSuffix(ctype, "+json") {
+		return string(body), nil
+	}
+	var value interface{}
+	err := json.Unmarshal(body, &value)
+	return value, err
+}
+
+func mediaTypeOf(header string) string {
+	if header == "" {
+		return ""
+	}
+	ctype, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return header
+	}
+	return ctype
+}
+
+func firstMediaType(content map[string]mediaType) string {
+	if _, ok := content["application/json"]; ok {
+		return "application/json"
+	}
+	for ctype := range content {
+		return ctype
+	}
+	return ""
+}
+
+// recorder запоминает статус и начало тела ответа для проверки.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(p)
+	if rec.body.Len() < maxCheckedBody {
+		rec.body.Write(p[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,158 @@
+// Package openapi — машиночитаемое описание API гофермарта (OpenAPI 3,
+// openapi.json) и проверка запросов и ответов по нему.
+//
+// Проверяется то подмножество OpenAPI, которым написан документ: пути с
+// шаблонами {name}, параметры query и header, тела application/json и
+// text/plain, схемы с type, properties, required, items, enum, minLength,
+// maxLength, pattern, format date-time, minimum, maximum и $ref на
+// components. Документ встроен в бинарник и меняется вместе с хендлерами.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec — документ OpenAPI в JSON.
+func Spec() []byte {
+	return spec
+}
+
+// документ разбирается один раз при старте; ошибка в нём — ошибка сборки
+var doc = mustParse(spec)
+
+type document struct {
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components struct {
+		Schemas    map[string]*Schema    `json:"schemas"`
+		Responses  map[string]*response  `json:"responses"`
+		Parameters map[string]*parameter `json:"parameters"`
+	} `json:"components"`
+
+	routes []route
+}
+
+type operation struct {
+	Parameters  []*parameter         `json:"parameters"`
+	RequestBody *requestBody         `json:"requestBody"`
+	Responses   map[string]*response `json:"responses"`
+}
+
+type parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Ref     string               `json:"$ref"`
+	Content map[string]mediaType `json:"content"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema — схема значения (подмножество JSON Schema из OpenAPI 3.0).
+type Schema struct {
+	Ref              string             `json:"$ref"`
+	Type             string             `json:"type"`
+	Format           string             `json:"format"`
+	Properties       map[string]*Schema `json:"properties"`
+	Required         []string           `json:"required"`
+	Items            *Schema            `json:"items"`
+	Enum             []interface{}      `json:"enum"`
+	MinLength        *int               `json:"minLength"`
+	MaxLength        *int               `json:"maxLength"`
+	Pattern          string             `json:"pattern"`
+	Minimum          *float64           `json:"minimum"`
+	Maximum          *float64           `json:"maximum"`
+	ExclusiveMinimum bool               `json:"exclusiveMinimum"`
+	Nullable         bool               `json:"nullable"`
+}
+
+// route — путь документа, разбитый на сегменты для сопоставления.
+type route struct {
+	segments []string
+	methods  map[string]*operation
+}
+
+func mustParse(data []byte) *document {
+	var d document
+	if err := json.Unmarshal(data, &d); err != nil {
+		panic(fmt.Sprintf("openapi: parse openapi.json: %v", err))
+	}
+	for path, methods := range d.Paths {
+		ops := make(map[string]*operation, len(methods))
+		for method, op := range methods {
+			ops[strings.ToUpper(method)] = op
+		}
+		d.routes = append(d.routes, route{segments: strings.Split(path, "/"), methods: ops})
+	}
+	return &d
+}
+
+// operation ищет операцию запроса; nil — путь или метод не описан.
+func (d *document) operation(method string, path string) *operation {
+	segments := strings.Split(path, "/")
+	for _, item := range d.routes {
+		if matchPath(item.segments, segments) {
+			return item.methods[method]
+		}
+	}
+	return nil
+}
+
+func matchPath(template []string, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+	for i, part := range template {
+		isParam := strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}")
+		if !isParam && part != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *document) schema(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+func (d *document) response(r *response) *response {
+	for r != nil && r.Ref != "" {
+		r = d.Components.Responses[strings.TrimPrefix(r.Ref, "#/components/responses/")]
+	}
+	return r
+}
+
+func (d *document) parameter(p *parameter) *parameter {
+	for p != nil && p.Ref != "" {
+		p = d.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+	}
+	return p
+}
+
+// ServeSpec отдаёт документ.
+func ServeSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(spec)
+}
@@ -0,0 +1,139 @@
+package openapi
+
+import (
+	"diplom_ya/internal/validation"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// validate сверяет значение из encoding/json (map, slice, float64,
+// string, bool, nil) со схемой; field — путь значения для ответа.
+func (d *document) validate(s *Schema, value interface{}, field string) validation.Errors {
+	s = d.schema(s)
+	if s == nil {
+		return nil
+	}
+	if value == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return validation.Errors{{Field: field, Rule: "type", Message: fmt.Sprintf("%s must be %s", name(field), s.Type)}}
+	}
+
+	typeError := validation.Errors{{Field: field, Rule: "type", Message: fmt.Sprintf("%s must be %s", name(field), s.Type)}}
+
+	var errs validation.Errors
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return typeError
+		}
+		for _, key := range s.Required {
+			if _, ok := obj[key]; !ok {
+				errs = append(errs, validation.Rule{Field: join(field, key), Rule: "required", Message: key + " is required"})
+			}
+		}
+		keys := make([]string, 0, len(s.Properties))
+		for key := range s.Properties {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if item, ok := obj[key]; ok {
+				errs = append(errs, d.validate(s.Properties[key], item, join(field, key))...)
+			}
+		}
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return typeError
+		}
+		for i, item := range list {
+			errs = append(errs, d.validate(s.Items, item, fmt.Sprintf("%s[%d]", field, i))...)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return typeError
+		}
+		errs = append(errs, checkString(s, str, field)...)
+	case "number", "integer":
+		num, ok := value.(float64)
+		if !ok || s.Type == "integer" && num != math.Trunc(num) {
+			return typeError
+		}
+		errs = append(errs, checkNumber(s, num, field)...)
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return typeError
+		}
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		errs = append(errs, validation.Rule{Field: field, Rule: "enum", Message: fmt.Sprintf("%s must be one of %v", name(field), s.Enum)})
+	}
+	return errs
+}
+
+func checkString(s *Schema, str string, field string) validation.Errors {
+	var errs validation.Errors
+	n := utf8.RuneCountInString(str)
+	if s.MinLength != nil && n < *s.MinLength {
+		errs = append(errs, validation.Rule{Field: field, Rule: "min_length", Message: fmt.Sprintf("%s must be at least %d characters", name(field), *s.MinLength)})
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		errs = append(errs, validation.Rule{Field: field, Rule: "max_length", Message: fmt.Sprintf("%s must be at most %d characters", name(field), *s.MaxLength)})
+	}
+	if s.Pattern != "" {
+		if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(str) {
+			errs = append(errs, validation.Rule{Field: field, Rule: "pattern", Message: fmt.Sprintf("%s must match %s", name(field), s.Pattern)})
+		}
+	}
+	if s.Format == "date-time" {
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			errs = append(errs, validation.Rule{Field: field, Rule: "format", Message: name(field) + " must be an RFC 3339 date-time"})
+		}
+	}
+	return errs
+}
+
+func checkNumber(s *Schema, num float64, field string) validation.Errors {
+	var errs validation.Errors
+	if s.Minimum != nil && (num < *s.Minimum || s.ExclusiveMinimum && num == *s.Minimum) {
+		errs = append(errs, validation.Rule{Field: field, Rule: "minimum", Message: fmt.Sprintf("%s must be greater than %v", name(field), *s.Minimum)})
+	}
+	if s.Maximum != nil && num > *s.Maximum {
+		errs = append(errs, validation.Rule{Field: field, Rule: "maximum", Message: fmt.Sprintf("%s must be at most %v", name(field), *s.Maximum)})
+	}
+	return errs
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, item := range enum {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func join(field string, key string) string {
+	if field == "" || field == "body" {
+		return key
+	}
+	return field + "." + key
+}
+
+// name — имя поля в сообщении.
+func name(field string) string {
+	if field == "" {
+		return "value"
+	}
+	return field[strings.LastIndex(field, ".")+1:]
+}
@@ -0,0 +1,114 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// Argon2id хеширует в формате PHC:
+// $argon2id$v=19$m=<KiB>,t=<проходы>,p=<потоки>$<соль>$<хеш>.
+type Argon2id struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+}
+
+type argon2Hash struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (a Argon2id) params() Argon2id {
+	// рекомендация OWASP: 19 MiB, 2 прохода, 1 поток
+	if a.Memory == 0 {
+		a.Memory = 19 * 1024
+	}
+	if a.Time == 0 {
+		a.Time = 2
+	}
+	if a.Threads == 0 {
+		a.Threads = 1
+	}
+	return a
+}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	a = a.params()
+
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Time, a.Memory, a.Threads, argon2KeyLen)
+
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Time, a.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+func (a Argon2id) Verify(password string, encoded string) (bool, error) {
+	h, err := parseArgon2(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+}
+
+func (a Argon2id) Match(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (a Argon2id) Current(encoded string) bool {
+	a = a.params()
+	h, err := parseArgon2(encoded)
+	if err != nil {
+		return false
+	}
+	return h.memory == a.Memory && h.time == a.Time && h.threads == a.Threads &&
+		len(h.salt) == argon2SaltLen && len(h.key) == argon2KeyLen
+}
+
+func parseArgon2(encoded string) (argon2Hash, error) {
+	var h argon2Hash
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return h, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return h, fmt.Errorf("password: unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.time, &h.threads); err != nil {
+		return h, fmt.Errorf("password: bad argon2 parameters %q", parts[3])
+	}
+	if h.memory == 0 || h.time == 0 || h.threads == 0 {
+		return h, fmt.Errorf("password: bad argon2 parameters %q", parts[3])
+	}
+
+	var err error
+	b64 := base64.RawStdEncoding
+	if h.salt, err = b64.DecodeString(parts[4]); err != nil {
+		return h, fmt.Errorf("password: bad argon2 salt: %w", err)
+	}
+	if h.key, err = b64.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return h, fmt.Errorf("password: bad argon2 hash")
+	}
+
+	return h, nil
+}
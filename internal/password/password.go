@@ -0,0 +1,65 @@
+// Package password хеширует пароли пользователей.
+//
+// Хеш хранится вместе с алгоритмом, солью и параметрами, поэтому параметры
+// можно ужесточать, а алгоритм — менять: старые хеши продолжают проверяться,
+// а Current подсказывает, что хеш пора пересчитать при успешном входе.
+package password
+
+import (
+	"diplom_ya/internal/config"
+	"errors"
+	"fmt"
+)
+
+var ErrUnknownFormat = errors.New("password: unknown hash format")
+
+// Hasher — алгоритм хеширования паролей.
+type Hasher interface {
+	// Hash возвращает хеш пароля со случайной солью и параметрами.
+	Hash(password string) (string, error)
+	// Verify проверяет пароль по хешу формата этого алгоритма.
+	Verify(password string, encoded string) (bool, error)
+	// Match сообщает, что хеш сделан этим алгоритмом.
+	Match(encoded string) bool
+	// Current сообщает, что хеш сделан этим алгоритмом с текущими параметрами.
+	Current(encoded string) bool
+}
+
+// New возвращает алгоритм, выбранный в cfg.PasswordHasher.
+func New(cfg config.Config) (Hasher, error) {
+	switch cfg.PasswordHasher {
+	case "", "argon2id":
+		return Argon2id{
+			Memory:  uint32(cfg.Argon2Memory),
+			Time:    uint32(cfg.Argon2Time),
+			Threads: uint8(cfg.Argon2Threads),
+		}, nil
+	case "bcrypt":
+		return Bcrypt{Cost: cfg.BcryptCost}, nil
+	default:
+		return nil, fmt.Errorf("password: unknown hasher %q", cfg.PasswordHasher)
+	}
+}
+
+// supported — алгоритмы, хеши которых можно проверить.
+var supported = []Hasher{Argon2id{}, Bcrypt{}}
+
+// Known сообщает, что хеш в одном из поддерживаемых форматов.
+func Known(encoded string) bool {
+	for _, h := range supported {
+		if h.Match(encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify проверяет пароль по хешу любого поддерживаемого формата.
+func Verify(password string, encoded string) (bool, error) {
+	for _, h := range supported {
+		if h.Match(encoded) {
+			return h.Verify(password, encoded)
+		}
+	}
+	return false, ErrUnknownFormat
+}
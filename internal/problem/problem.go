@@ -0,0 +1,109 @@
+// Package problem — ответы об ошибках в формате RFC 7807
+// (application/problem+json):
+//
+//	{"type": "urn:gophermart:problem:validation_failed", "title": "Bad Request",
+//	 "status": 400, "code": "validation_failed", "detail": "...",
+//	 "instance": "/api/user/register", "request_id": "...",
+//	 "errors": [{"field": "password", "rule": "min_length", "message": "..."}]}
+//
+// Клиенты ветвятся по code; detail — текст для человека и может меняться.
+// request_id совпадает с заголовком X-Request-ID ответа и строкой в логе.
+package problem
+
+import (
+	"diplom_ya/internal/validation"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ContentType — тип тела ответа об ошибке.
+const ContentType = "application/problem+json"
+
+// Коды ошибок.
+const (
+	CodeBadRequest          = "bad_request"            // тело или параметры не разобрать
+	CodeValidation          = "validation_failed"      // нарушены правила, см. errors
+	CodeUnsupportedMedia    = "unsupported_media_type" // Content-Type тела не описан
+	CodeBodyTooLarge        = "body_too_large"         // тело запроса больше допустимого
+	CodeUnauthorized        = "unauthorized"           // нет действующей сессии
+	CodeInvalidToken        = "invalid_token"          // access-токен неверен или истёк
+	CodeForbidden           = "forbidden"              // нет нужной роли
+	CodeInvalidCredentials  = "invalid_credentials"    // неверная пара логин/пароль
+	CodeOTPRequired         = "otp_required"           // нужен одноразовый код
+	CodeInvalidOTP          = "invalid_otp"            // одноразовый код неверен
+	CodeTooManyAttempts     = "too_many_attempts"      // вход временно закрыт, см. Retry-After
+	CodeLoginTaken          = "login_taken"            // логин занят
+	CodeInvalidRefreshToken = "invalid_refresh_token"  // refresh-токен неверен, истёк или отозван
+	CodeWrongPassword       = "wrong_password"         // неверный текущий пароль
+	CodeInvalidResetToken   = "invalid_reset_token"    // токен сброса неверен, истёк или использован
+	CodeTOTPEnabled         = "totp_enabled"           // второй фактор уже включён
+	CodeTOTPNotStarted      = "totp_not_started"       // секрет второго фактора не выдан
+	CodeTOTPDisabled        = "totp_disabled"          // второй фактор выключен: не задан ENCRYPTION_KEYS
+	CodeInvalidOrder        = "invalid_order_number"   // номер заказа не проходит проверку Луна
+	CodeOrderTaken          = "order_taken"            // номер загружен другим пользователем
+	CodeInsufficientFunds   = "insufficient_funds"     // на счёте недостаточно баллов
+	CodeIdempotencyConflict = "idempotency_conflict"   // ключ идемпотентности занят другим запросом
+	CodeNotFound            = "not_found"              // нет такого пути
+	CodeMethodNotAllowed    = "method_not_allowed"     // путь есть, метод не поддерживается
+	CodeInternal            = "internal"               // внутренняя ошибка сервера
+)
+
+// Problem — тело ответа об ошибке.
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Code      string            `json:"code"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Errors    validation.Errors `json:"errors,omitempty"`
+}
+
+// New собирает ответ об ошибке запроса r.
+func New(r *http.Request, status int, code string, detail string) Problem {
+	return Problem{
+		Type:      "urn:gophermart:problem:" + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Code:      code,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: RequestIDFromContext(r.Context()),
+	}
+}
+
+// Write отвечает ошибкой.
+func Write(w http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	Send(w, New(r, status, code, detail))
+}
+
+// Validation отвечает 400 со списком нарушенных правил.
+func Validation(w http.ResponseWriter, r *http.Request, rules validation.Errors) {
+	p := New(r, http.StatusBadRequest, CodeValidation, "request violates validation rules")
+	p.Errors = rules
+	Send(w, p)
+}
+
+// Internal пишет err в лог с идентификатором запроса и отвечает 500 без
+// подробностей.
+func Internal(w http.ResponseWriter, r *http.Request, err error) {
+	p := New(r, http.StatusInternalServerError, CodeInternal, "internal server error")
+	log.Printf("%s %s [%s]: %v", r.Method, r.URL.Path, p.RequestID, err)
+	Send(w, p)
+}
+
+// Send записывает p.
+func Send(w http.ResponseWriter, p Problem) {
+	result, err := json.Marshal(p)
+	if err != nil {
+		result = []byte(`{"type":"about:blank","status":500,"code":"internal"}`)
+		p.Status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	w.Write(result)
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Области учёта неудачных попыток входа.
+const (
+	ScopeLogin = "login"
+	ScopeIP    = "ip"
+)
+
+// LoginAttempts — неудачные попытки входа по логину или IP.
+type LoginAttempts struct {
+	Failures    int
+	LockedUntil time.Time
+}
+
+// ReserveLoginAttempt засчитывает попытку входа в момент now неудачей
+// заранее, до проверки пароля, и закрывает вход на lockFor(неудач подряд):
+// параллельные попытки видят счётчик друг друга и не проскакивают
+// задержку. Неудачи старше since не считаются. Если вход уже закрыт,
+// попытка не засчитывается, а возвращается срок блокировки.
+func (s *DB) ReserveLoginAttempt(ctx context.Context, scope string, key string, now time.Time, since time.Time, lockFor func(failures int) time.Duration) (time.Time, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer tx.Rollback()
+
+	textInsert := `
+	INSERT INTO login_attempts ("scope", "key", "failures", "last_failure")
+	VALUES ($1, $2, 0, $3)
+	ON CONFLICT ("scope", "key") DO NOTHING`
+	if _, err := tx.ExecContext(ctx, textInsert, scope, key, now); err != nil {
+		return time.Time{}, err
+	}
+
+	var (
+		failures    int
+		lastFailure time.Time
+		locked      sql.NullTime
+	)
+	textQuery := `SELECT "failures", "last_failure", "locked_until" FROM login_attempts
+	WHERE "scope" = $1 AND "key" = $2 FOR UPDATE`
+	if err := tx.QueryRowContext(ctx, textQuery, scope, key).Scan(&failures, &lastFailure, &locked); err != nil {
+		return time.Time{}, err
+	}
+	if locked.Valid && locked.Time.After(now) {
+		return locked.Time, nil
+	}
+
+	if lastFailure.Before(since) {
+		failures = 0
+	}
+	failures++
+	var until sql.NullTime
+	if lock := lockFor(failures); lock > 0 {
+		until = sql.NullTime{Time: now.Add(lock), Valid: true}
+	}
+
+	textUpdate := `UPDATE login_attempts SET "failures" = $3, "last_failure" = $4, "locked_until" = $5
+	WHERE "scope" = $1 AND "key" = $2`
+	if _, err := tx.ExecContext(ctx, textUpdate, scope, key, failures, now, until); err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Time{}, tx.Commit()
+}
+
+// ReleaseLoginAttempt возвращает попытку, засчитанную ReserveLoginAttempt,
+// если она оказалась не неудачей, и снимает блокировку, которой по
+// оставшимся неудачам не положено.
+func (s *DB) ReleaseLoginAttempt(ctx context.Context, scope string, key string, lockFor func(failures int) time.Duration) error {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var failures int
+	textQuery := `SELECT "failures" FROM login_attempts WHERE "scope" = $1 AND "key" = $2 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, textQuery, scope, key).Scan(&failures)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		return err
+	}
+
+	if failures > 0 {
+		failures--
+	}
+	textUpdate := `UPDATE login_attempts SET "failures" = $3 WHERE "scope" = $1 AND "key" = $2`
+	if lockFor(failures) == 0 {
+		textUpdate = `UPDATE login_attempts SET "failures" = $3, "locked_until" = NULL WHERE "scope" = $1 AND "key" = $2`
+	}
+	if _, err := tx.ExecContext(ctx, textUpdate, scope, key, failures); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ClearLoginAttempts сбрасывает неудачи и блокировку.
+func (s *DB) ClearLoginAttempts(ctx context.Context, scope string, key string) error {
+
+	textDelete := `DELETE FROM login_attempts WHERE "scope" = $1 AND "key" = $2`
+	_, err := s.db.ExecContext(ctx, textDelete, scope, key)
+	return err
+}
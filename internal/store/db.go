@@ -4,79 +4,58 @@ import (
 	"context"
 	"database/sql"
 	"diplom_ya/internal/config"
-	"diplom_ya/internal/workers"
+	"diplom_ya/internal/money"
+	"errors"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
 	_ "github.com/jackc/pgx/v4/stdlib"
 )
 
-func DBInit(cfg *config.Config) error {
+// DB — хранилище в PostgreSQL.
+type DB struct {
+	db  *sql.DB
+	cfg config.Config
+}
+
+func NewDB(cfg config.Config) (*DB, error) {
 
-	db, err := sql.Open("pgx", cfg.DataBase)
+	db, err := Open(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// users
-	textCreate := `CREATE TABLE IF NOT EXISTS users(
-		"userID" TEXT,
-		"login" TEXT PRIMARY KEY,
-		"hash" TEXT,
-		"balanse" FLOAT 
-		 );`
-	if _, err := db.Exec(textCreate); err != nil {
-		return err
-	}
-	// accumulation
-	textCreate = `CREATE TABLE IF NOT EXISTS accum(
-		"userID" TEXT,
-		"order" TEXT PRIMARY KEY,
-		"sum" FLOAT,
-		"date" DATE,
-		"status" TEXT
-		 );`
-	if _, err := db.Exec(textCreate); err != nil {
-		return err
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		return nil, err
 	}
-	// subtraction
-	textCreate = `CREATE TABLE IF NOT EXISTS subtract(
-		"userID" TEXT,
-		"order" TEXT PRIMARY KEY,
-		"sum" FLOAT,
-		"date" DATE
-		 );`
-	if _, err := db.Exec(textCreate); err != nil {
-		return err
+	if err := migrator.Up(context.Background()); err != nil {
+		return nil, err
 	}
 
-	cfg.ConnectDB = db
-	return nil
+	return &DB{db: db, cfg: cfg}, nil
 }
 
-func LoginUse(ctx context.Context, cfg config.Config, login string) (bool, error) {
-	var userID string
-
-	db := cfg.ConnectDB
+func (s *DB) Close() error {
+	return s.db.Close()
+}
 
-	textQuery := `SELECT "userID" FROM users WHERE "login" = $1`
-	err := db.QueryRowContext(ctx, textQuery, login).Scan(&userID)
+// код PostgreSQL unique_violation
+const uniqueViolation = "23505"
 
-	switch {
-	case err == sql.ErrNoRows:
-		return false, nil
-	case err != nil:
-		return false, err
-	default:
-		return true, nil
-	}
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
 }
 
-func WriteNewUser(ctx context.Context, cfg config.Config, login string, hash string) (string, error) {
+// WriteNewUser добавляет пользователя; занятый логин (в том числе в другом
+// регистре) — ErrDuplicate. Проверку занятости делает уникальный индекс,
+// поэтому одновременные регистрации одного логина не гонятся.
+func (s *DB) WriteNewUser(ctx context.Context, login string, hash string) (string, error) {
 
-	db := cfg.ConnectDB
+	db := s.db
 
 	userID := uuid.New().String()
 	textInsert := `
@@ -84,35 +63,59 @@ func WriteNewUser(ctx context.Context, cfg config.Config, login string, hash str
 	VALUES ($1, $2, $3, $4)`
 	_, err := db.ExecContext(ctx, textInsert, userID, login, hash, 0)
 
-	if err != nil {
+	switch {
+	case isUniqueViolation(err):
+		return "", ErrDuplicate
+	case err != nil:
 		return "", err
 	}
 
 	return userID, nil
 }
 
-func ReadUser(ctx context.Context, cfg config.Config, login string, hash string) (string, error) {
-	var userID string
+func (s *DB) ReadUser(ctx context.Context, login string) (userID string, hash string, err error) {
 
-	db := cfg.ConnectDB
+	db := s.db
 
-	textQuery := `SELECT "userID" FROM users WHERE "login" = $1 AND "hash" = $2`
-	err := db.QueryRowContext(ctx, textQuery, login, hash).Scan(&userID)
+	textQuery := `SELECT "userID", "hash" FROM users WHERE lower("login") = lower($1)`
+	err = db.QueryRowContext(ctx, textQuery, login).Scan(&userID, &hash)
 
 	switch {
 	case err == sql.ErrNoRows:
-		return "", nil
+		return "", "", nil
 	case err != nil:
-		return "", err
+		return "", "", err
 	default:
-		return userID, nil
+		return userID, hash, nil
 	}
 }
 
-func ExistsUserID(ctx context.Context, cfg config.Config, userID string) (bool, error) {
+func (s *DB) ReadUserByID(ctx context.Context, userID string) (login string, hash string, err error) {
+
+	textQuery := `SELECT "login", "hash" FROM users WHERE "userID" = $1`
+	err = s.db.QueryRowContext(ctx, textQuery, userID).Scan(&login, &hash)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return "", "", nil
+	case err != nil:
+		return "", "", err
+	default:
+		return login, hash, nil
+	}
+}
+
+func (s *DB) UpdatePasswordHash(ctx context.Context, userID string, hash string) error {
+
+	textUpdate := `UPDATE users SET "hash" = $1 WHERE "userID" = $2`
+	_, err := s.db.ExecContext(ctx, textUpdate, hash, userID)
+	return err
+}
+
+func (s *DB) ExistsUserID(ctx context.Context, userID string) (bool, error) {
 	var login string
 
-	db := cfg.ConnectDB
+	db := s.db
 
 	textQuery := `SELECT "login" FROM users WHERE "userID" = $1`
 	err := db.QueryRowContext(ctx, textQuery, userID).Scan(&login)
@@ -127,45 +130,103 @@ func ExistsUserID(ctx context.Context, cfg config.Config, userID string) (bool,
 	}
 }
 
-func GetBalanseSpent(ctx context.Context, cfg config.Config, userID string) (balance float32, spent float32, err error) {
+// GetRoles возвращает роли пользователя из user_roles.
+func (s *DB) GetRoles(ctx context.Context, userID string) ([]string, error) {
+
+	textQuery := `SELECT "role" FROM user_roles WHERE "userID" = $1 ORDER BY "role"`
+	rows, err := s.db.QueryContext(ctx, textQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		out = append(out, role)
+	}
+
+	return out, rows.Err()
+}
+
+func (s *DB) GrantRole(ctx context.Context, userID string, role string) error {
+
+	textInsert := `INSERT INTO user_roles ("userID", "role") VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	_, err := s.db.ExecContext(ctx, textInsert, userID, role)
+	return err
+}
+
+func (s *DB) RevokeRole(ctx context.Context, userID string, role string) error {
+
+	textDelete := `DELETE FROM user_roles WHERE "userID" = $1 AND "role" = $2`
+	_, err := s.db.ExecContext(ctx, textDelete, userID, role)
+	return err
+}
 
-	db := cfg.ConnectDB
+func (s *DB) GetBalanseSpent(ctx context.Context, userID string) (balance money.Amount, spent money.Amount, err error) {
+
+	db := s.db
 
 	textQuery := `SELECT max(users."balanse"), sum(COALESCE(subtract."sum",0))
-	FROM users left join subtract on users."userID" = subtract."userID"
+	FROM users left join subtract on users."userID" = subtract."userID" AND subtract."status" <> 'reversed'
 	where users."userID" = $1`
 
 	err = db.QueryRowContext(ctx, textQuery, userID).Scan(&balance, &spent)
 	return
 }
 
-func AddOrder(ctx context.Context, cfg config.Config, order string, userID string) int {
-	mu := &sync.Mutex{}
-	mu.Lock()
-	defer mu.Unlock()
+// AddOrder добавляет заказ и ставит его в очередь расчёта. Заказ
+// вставляется сразу, без предварительной проверки: если номер уже есть,
+// уникальный ключ отклонит вставку, и по владельцу заказа вернётся 200
+// или 409.
+func (s *DB) AddOrder(ctx context.Context, order string, userID string) int {
 
-	var receivedUserID string
+	db := s.db
 
-	db := cfg.ConnectDB
+	// add in db, в очередь расчёта — в той же транзакции
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	defer tx.Rollback()
 
-	textQuery := `SELECT "userID" FROM accum WHERE "order" = $1`
-	err := db.QueryRowContext(ctx, textQuery, order).Scan(&receivedUserID)
+	textInsert := `
+	INSERT INTO accum ("userID", "order", "sum", "date", "status")
+	VALUES ($1, $2, $3, $4, $5)`
+	_, err = tx.ExecContext(ctx, textInsert, userID, order, 0, time.Now(), s.cfg.OrdersStatus.New)
 
 	switch {
-	case err == sql.ErrNoRows:
-		// add in db
-		textInsert := `
-		INSERT INTO accum ("userID", "order", "sum", "date", "status")
-		VALUES ($1, $2, $3, $4, $5)`
-		_, err = db.ExecContext(ctx, textInsert, userID, order, 0, time.Now(), cfg.OrdersStatus.New)
+	case isUniqueViolation(err):
+		tx.Rollback()
+		return s.orderOwnerStatus(ctx, order, userID)
+	case err != nil:
+		return http.StatusInternalServerError
+	}
 
-		if err != nil {
-			return http.StatusInternalServerError
-		}
+	if err := enqueueOrder(ctx, tx, order); err != nil {
+		return http.StatusInternalServerError
+	}
+
+	if err := tx.Commit(); err != nil {
+		return http.StatusInternalServerError
+	}
+
+	return http.StatusAccepted
+}
+
+// orderOwnerStatus — ответ на повторную загрузку номера: 200, если заказ
+// уже загружен этим пользователем, 409 — если другим.
+func (s *DB) orderOwnerStatus(ctx context.Context, order string, userID string) int {
 
-		workers.AddOrderToChannelProc(cfg, order)
+	var receivedUserID string
+
+	textQuery := `SELECT "userID" FROM accum WHERE "order" = $1`
+	err := s.db.QueryRowContext(ctx, textQuery, order).Scan(&receivedUserID)
 
-		return http.StatusAccepted
+	switch {
 	case err != nil:
 		return http.StatusInternalServerError
 	case receivedUserID != userID:
@@ -175,17 +236,18 @@ func AddOrder(ctx context.Context, cfg config.Config, order string, userID strin
 	}
 }
 
-func GetAccum(ctx context.Context, cfg config.Config, userID string) ([]config.OutAccum, error) {
+func (s *DB) GetAccum(ctx context.Context, userID string, filter ListFilter) ([]config.OutAccum, error) {
 
-	db := cfg.ConnectDB
+	db := s.db
 
 	textQuery := `SELECT "order", "sum", "date", "status"
-	FROM  accum 
-	where "userID" = $1 ORDER BY "date"`
+	FROM  accum
+	where "userID" = $1`
+	where, args := filter.where([]interface{}{userID})
 
 	var out []config.OutAccum
 
-	rows, err := db.QueryContext(ctx, textQuery, userID)
+	rows, err := db.QueryContext(ctx, textQuery+where, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -208,21 +270,55 @@ func GetAccum(ctx context.Context, cfg config.Config, userID string) ([]config.O
 	return out, err
 }
 
-func WriteWithdraw(ctx context.Context, cfg config.Config, order string, sum float32, userID string) int {
-
-	mu := &sync.Mutex{}
-	mu.Lock()
-	defer mu.Unlock()
-
-	db := cfg.ConnectDB
+// WriteWithdraw списывает баллы. Списания одного пользователя
+// сериализуются блокировкой его строки в users (SELECT ... FOR UPDATE).
+// Непустой idempotencyKey делает повтор запроса безопасным: успешное
+// списание с тем же ключом и теми же order/sum возвращает 200 без
+// повторного списания, с другими order/sum — 422.
+func (s *DB) WriteWithdraw(ctx context.Context, order string, sum money.Amount, userID string, idempotencyKey string) int {
 
-	tx, err := db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return http.StatusInternalServerError
 	}
 	defer tx.Rollback()
 
-	balance, _, err := GetBalanseSpent(ctx, cfg, userID)
+	if idempotencyKey != "" {
+		// ключ вставляется в той же транзакции: параллельный запрос с тем же
+		// ключом дождётся её завершения на уникальном индексе
+		textInsert := `
+		INSERT INTO idempotency_keys ("userID", "key", "order", "sum")
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`
+		result, err := tx.ExecContext(ctx, textInsert, userID, idempotencyKey, order, sum)
+		if err != nil {
+			return http.StatusInternalServerError
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return http.StatusInternalServerError
+		}
+		if inserted == 0 {
+			var (
+				doneOrder string
+				doneSum   money.Amount
+			)
+			textQuery := `SELECT "order", "sum" FROM idempotency_keys WHERE "userID" = $1 AND "key" = $2`
+			err = tx.QueryRowContext(ctx, textQuery, userID, idempotencyKey).Scan(&doneOrder, &doneSum)
+			if err != nil {
+				return http.StatusInternalServerError
+			}
+			if doneOrder != order || doneSum != sum {
+				return http.StatusUnprocessableEntity
+			}
+			return http.StatusOK
+		}
+	}
+
+	var balance money.Amount
+
+	textQuery := `SELECT COALESCE("balanse", 0) FROM users WHERE "userID" = $1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, textQuery, userID).Scan(&balance)
 	if err != nil {
 		return http.StatusInternalServerError
 	}
@@ -233,37 +329,38 @@ func WriteWithdraw(ctx context.Context, cfg config.Config, order string, sum flo
 
 	// add in db
 	textInsert := `
-		INSERT INTO subtract ("userID", "order", "sum", "date")
-		VALUES ($1, $2, $3, $4)`
-	_, err = db.ExecContext(ctx, textInsert, userID, order, sum, time.Now())
+		INSERT INTO subtract ("userID", "order", "sum", "date", "status")
+		VALUES ($1, $2, $3, $4, $5)`
+	_, err = tx.ExecContext(ctx, textInsert, userID, order, sum, time.Now(), WithdrawalCompleted)
 
 	if err != nil {
 		return http.StatusInternalServerError
 	}
 
-	textInsert = `
-		UPDATE users set "balanse" = "balanse" - $1 where "userID" = $2`
-	_, err = db.ExecContext(ctx, textInsert, sum, userID)
+	_, err = postEntry(ctx, tx, KindWithdrawal, userID, -sum, AccountWithdrawal, order, "")
 	if err != nil {
 		return http.StatusInternalServerError
 	}
 
-	tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return http.StatusInternalServerError
+	}
 
 	return http.StatusOK
 }
 
-func GetWithdrawals(ctx context.Context, cfg config.Config, userID string) ([]config.OutWithdrawals, error) {
+func (s *DB) GetWithdrawals(ctx context.Context, userID string, filter ListFilter) ([]config.OutWithdrawals, error) {
 
-	db := cfg.ConnectDB
+	db := s.db
 
-	textQuery := `SELECT "order", "sum", "date"
-	FROM  subtruct 
-	where "userID" = $1 ORDER BY "date"`
+	textQuery := `SELECT "order", "sum", "date", "status"
+	FROM  subtract
+	where "userID" = $1`
+	where, args := filter.where([]interface{}{userID})
 
 	var out []config.OutWithdrawals
 
-	rows, err := db.QueryContext(ctx, textQuery, userID)
+	rows, err := db.QueryContext(ctx, textQuery+where, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -274,7 +371,7 @@ func GetWithdrawals(ctx context.Context, cfg config.Config, userID string) ([]co
 	}
 	for rows.Next() {
 		var item config.OutWithdrawals
-		err = rows.Scan(&item.Order, &item.Sum, &item.Date)
+		err = rows.Scan(&item.Order, &item.Sum, &item.Date, &item.Status)
 		if err != nil {
 			return nil, err
 		}
@@ -284,3 +381,86 @@ func GetWithdrawals(ctx context.Context, cfg config.Config, userID string) ([]co
 
 	return out, err
 }
+
+func (s *DB) GetUserID(ctx context.Context, order string) (string, error) {
+
+	db := s.db
+
+	textQuery := `SELECT "userID" FROM accum WHERE "order" = $1`
+	rows, err := db.QueryContext(ctx, textQuery, order)
+
+	if err != nil {
+		return "", errors.New("error get userID")
+	}
+	defer rows.Close()
+
+	var userID string
+
+	for rows.Next() {
+		err = rows.Scan(&userID)
+		if err != nil {
+			return "", errors.New("error scan rows in db")
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return "", errors.New("rows error in db")
+	}
+
+	return userID, nil
+}
+
+// UpdateOrder записывает результат расчёта. Начисление проводится только
+// при переходе в окончательный статус, поэтому повторная обработка заказа
+// (например, после истечения аренды в очереди) не начислит баллы дважды.
+// Заказ в окончательном статусе удаляется из очереди.
+func (s *DB) UpdateOrder(ctx context.Context, order string, status string, sum money.Amount, userID string) error {
+
+	db := s.db
+	statuses := s.cfg.OrdersStatus
+
+	// Начало транзацкции
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if status == statuses.Processed {
+
+		textQuery := `UPDATE accum SET "sum" = $1, "status" = $2
+		WHERE "order" = $3 AND "status" NOT IN ($4, $5)`
+		result, err := tx.ExecContext(ctx, textQuery, sum, status, order, statuses.Processed, statuses.Invalid)
+		if err != nil {
+			return err
+		}
+		updated, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if updated > 0 && sum > 0 {
+			_, err = postEntry(ctx, tx, KindAccrual, userID, sum, AccountAccrual, order, "")
+			if err != nil {
+				return err
+			}
+		}
+
+	} else {
+		textQuery := `UPDATE accum SET "status" = $1 WHERE "order" = $2 AND "status" NOT IN ($3, $4)`
+		_, err = tx.ExecContext(ctx, textQuery, status, order, statuses.Processed, statuses.Invalid)
+		if err != nil {
+			return err
+		}
+	}
+
+	if status == statuses.Processed || status == statuses.Invalid {
+		textDelete := `DELETE FROM order_queue WHERE "order" = $1`
+		if _, err := tx.ExecContext(ctx, textDelete, order); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"diplom_ya/internal/money"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Виды записей журнала проводок.
+const (
+	KindAccrual    = "accrual"    // начисление за обработанный заказ
+	KindWithdrawal = "withdrawal" // списание в счёт оплаты заказа
+	KindAdjustment = "adjustment" // ручная корректировка
+	KindReversal   = "reversal"   // сторнирование записи
+)
+
+// Статусы списаний. Списание проводится сразу, в одной транзакции с
+// проверкой баланса; pending зарезервирован для списаний, проводимых
+// позже. Сторнированное списание (ReverseEntry) — reversed, его сумма
+// возвращена на баланс и не входит в withdrawn.
+const (
+	WithdrawalPending   = "pending"
+	WithdrawalCompleted = "completed"
+	WithdrawalReversed  = "reversed"
+)
+
+// Системные счета — корреспонденты счетов пользователей.
+const (
+	AccountAccrual    = "system:accrual"
+	AccountWithdrawal = "system:withdrawal"
+	AccountAdjustment = "system:adjustment"
+)
+
+// UserAccount — счёт баллов пользователя в журнале.
+func UserAccount(userID string) string {
+	return "user:" + userID
+}
+
+// Posting — проводка журнала. Журнал только дополняется: ошибочную запись
+// не правят, а сторнируют новой записью с Reverses.
+type Posting struct {
+	ID       int64
+	EntryID  string
+	Account  string
+	Kind     string
+	Amount   money.Amount
+	Order    string
+	Reverses string
+	Comment  string
+	Date     time.Time
+}
+
+// Drift — расхождение кэшированного баланса users.balanse с журналом.
+type Drift struct {
+	UserID string
+	Cached money.Amount
+	Ledger money.Amount
+}
+
+// Reconciliation — результат сверки журнала.
+type Reconciliation struct {
+	Drifts     []Drift  // баланс пользователя не совпадает с суммой проводок
+	Unbalanced []string // записи, проводки которых не дают в сумме ноль
+}
+
+func (r Reconciliation) OK() bool {
+	return len(r.Drifts) == 0 && len(r.Unbalanced) == 0
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// postEntry записывает в журнал пару проводок: amount на счёт пользователя
+// и -amount на счёт-корреспондент, и меняет кэшированный баланс.
+func postEntry(ctx context.Context, db execer, kind string, userID string, amount money.Amount, counter string, order string, comment string) (string, error) {
+
+	entryID := uuid.New().String()
+
+	textInsert := `
+	INSERT INTO ledger ("entryID", "account", "kind", "amount", "order", "comment")
+	VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, '')), ($1, $7, $3, $8, NULLIF($5, ''), NULLIF($6, ''))`
+	_, err := db.ExecContext(ctx, textInsert, entryID, UserAccount(userID), kind, amount, order, comment, counter, -amount)
+	if err != nil {
+		return "", err
+	}
+
+	textUpdate := `UPDATE users SET "balanse" = "balanse" + $1 WHERE "userID" = $2`
+	_, err = db.ExecContext(ctx, textUpdate, amount, userID)
+	if err != nil {
+		return "", err
+	}
+
+	return entryID, nil
+}
+
+func (s *DB) PostAdjustment(ctx context.Context, userID string, amount money.Amount, comment string) (string, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// пользователь проверяется в транзакции и блокируется до её конца
+	var one int
+	textQuery := `SELECT 1 FROM users WHERE "userID" = $1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, textQuery, userID).Scan(&one)
+	switch {
+	case err == sql.ErrNoRows:
+		return "", errNotFound
+	case err != nil:
+		return "", err
+	}
+
+	entryID, err := postEntry(ctx, tx, KindAdjustment, userID, amount, AccountAdjustment, "", comment)
+	if err != nil {
+		return "", err
+	}
+
+	return entryID, tx.Commit()
+}
+
+func (s *DB) ReverseEntry(ctx context.Context, entryID string, comment string) (string, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	// FOR UPDATE: параллельное сторнирование той же записи ждёт этой транзакции
+	textQuery := `SELECT "account", "kind", "amount", COALESCE("order", '') FROM ledger WHERE "entryID" = $1 FOR UPDATE`
+	rows, err := tx.QueryContext(ctx, textQuery, entryID)
+	if err != nil {
+		return "", err
+	}
+
+	var postings []Posting
+	for rows.Next() {
+		var item Posting
+		if err := rows.Scan(&item.Account, &item.Kind, &item.Amount, &item.Order); err != nil {
+			rows.Close()
+			return "", err
+		}
+		postings = append(postings, item)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(postings) == 0 {
+		return "", errNotFound
+	}
+	if postings[0].Kind == KindReversal {
+		return "", errReversed
+	}
+
+	var reversed bool
+	textQuery = `SELECT EXISTS(SELECT 1 FROM ledger WHERE "reverses" = $1)`
+	if err := tx.QueryRowContext(ctx, textQuery, entryID).Scan(&reversed); err != nil {
+		return "", err
+	}
+	if reversed {
+		return "", errReversed
+	}
+
+	reversalID := uuid.New().String()
+	for _, item := range postings {
+		textInsert := `
+		INSERT INTO ledger ("entryID", "account", "kind", "amount", "order", "reverses", "comment")
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, NULLIF($7, ''))`
+		_, err = tx.ExecContext(ctx, textInsert, reversalID, item.Account, KindReversal, -item.Amount, item.Order, entryID, comment)
+		switch {
+		case isUniqueViolation(err):
+			// ledger_reverses: сторнировали, пока шла проверка
+			return "", errReversed
+		case err != nil:
+			return "", err
+		}
+
+		textUpdate := `UPDATE users SET "balanse" = "balanse" - $1 WHERE 'user:' || "userID" = $2`
+		_, err = tx.ExecContext(ctx, textUpdate, item.Amount, item.Account)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if kind, order := postings[0].Kind, postings[0].Order; kind == KindWithdrawal && order != "" {
+		textUpdate := `UPDATE subtract SET "status" = $2 WHERE "order" = $1`
+		_, err = tx.ExecContext(ctx, textUpdate, order, WithdrawalReversed)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return reversalID, tx.Commit()
+}
+
+func (s *DB) GetLedger(ctx context.Context, userID string) ([]Posting, error) {
+
+	textQuery := `SELECT "id", "entryID", "account", "kind", "amount",
+	COALESCE("order", ''), COALESCE("reverses"::text, ''), COALESCE("comment", ''), "date"
+	FROM ledger WHERE "account" = $1 ORDER BY "id"`
+
+	rows, err := s.db.QueryContext(ctx, textQuery, UserAccount(userID))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Posting
+	for rows.Next() {
+		var item Posting
+		err = rows.Scan(&item.ID, &item.EntryID, &item.Account, &item.Kind, &item.Amount,
+			&item.Order, &item.Reverses, &item.Comment, &item.Date)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+
+	return out, rows.Err()
+}
+
+func (s *DB) Reconcile(ctx context.Context) (Reconciliation, error) {
+
+	var out Reconciliation
+
+	textQuery := `SELECT u."userID", COALESCE(u."balanse", 0), COALESCE(l."sum", 0)
+	FROM users u LEFT JOIN (
+		SELECT "account", sum("amount") AS "sum" FROM ledger GROUP BY "account"
+	) l ON l."account" = 'user:' || u."userID"
+	WHERE COALESCE(u."balanse", 0) <> COALESCE(l."sum", 0)`
+
+	rows, err := s.db.QueryContext(ctx, textQuery)
+	if err != nil {
+		return out, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Drift
+		if err := rows.Scan(&item.UserID, &item.Cached, &item.Ledger); err != nil {
+			return out, err
+		}
+		out.Drifts = append(out.Drifts, item)
+	}
+	if err := rows.Err(); err != nil {
+		return out, err
+	}
+
+	textQuery = `SELECT "entryID" FROM ledger GROUP BY "entryID" HAVING sum("amount") <> 0`
+
+	entries, err := s.db.QueryContext(ctx, textQuery)
+	if err != nil {
+		return out, err
+	}
+	defer entries.Close()
+
+	for entries.Next() {
+		var entryID string
+		if err := entries.Scan(&entryID); err != nil {
+			return out, err
+		}
+		out.Unbalanced = append(out.Unbalanced, entryID)
+	}
+
+	return out, entries.Err()
+}
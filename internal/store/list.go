@@ -0,0 +1,87 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Cursor — последняя выданная запись списка; следующая страница
+// начинается сразу после неё. Списки упорядочены по дате, затем по
+// номеру заказа, поэтому порядок не меняется от запроса к запросу.
+type Cursor struct {
+	Date  time.Time
+	Order string
+}
+
+// IsZero — курсор не задан, список с начала.
+func (c Cursor) IsZero() bool {
+	return c.Order == "" && c.Date.IsZero()
+}
+
+// ListFilter — страница списка заказов или списаний пользователя.
+type ListFilter struct {
+	Limit  int      // 0 — без ограничения
+	After  Cursor   // записи после курсора
+	Status []string // только эти статусы; пусто — любые
+	From   time.Time
+	To     time.Time // [From, To); нулевое значение — без границы
+}
+
+// before — запись (date, order) идёт раньше курсора или совпадает с ним.
+func (c Cursor) before(date time.Time, order string) bool {
+	return date.Before(c.Date) || date.Equal(c.Date) && order <= c.Order
+}
+
+// match — запись проходит фильтр (кроме Limit).
+func (f ListFilter) match(date time.Time, order string, status string) bool {
+	if !f.After.IsZero() && f.After.before(date, order) {
+		return false
+	}
+	if !f.From.IsZero() && date.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !date.Before(f.To) {
+		return false
+	}
+	if len(f.Status) > 0 {
+		found := false
+		for _, item := range f.Status {
+			found = found || item == status
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// where дописывает к запросу условия фильтра, порядок и LIMIT; args —
+// уже занятые параметры запроса.
+func (f ListFilter) where(args []interface{}) (string, []interface{}) {
+	var b strings.Builder
+
+	param := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if !f.After.IsZero() {
+		fmt.Fprintf(&b, ` AND ("date", "order") > (%s, %s)`, param(f.After.Date), param(f.After.Order))
+	}
+	if !f.From.IsZero() {
+		fmt.Fprintf(&b, ` AND "date" >= %s`, param(f.From))
+	}
+	if !f.To.IsZero() {
+		fmt.Fprintf(&b, ` AND "date" < %s`, param(f.To))
+	}
+	if len(f.Status) > 0 {
+		fmt.Fprintf(&b, ` AND "status" = ANY(%s)`, param(f.Status))
+	}
+	b.WriteString(` ORDER BY "date", "order"`)
+	if f.Limit > 0 {
+		fmt.Fprintf(&b, ` LIMIT %s`, param(f.Limit))
+	}
+
+	return b.String(), args
+}
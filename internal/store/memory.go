@@ -0,0 +1,883 @@
+package store
+
+import (
+	"context"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/money"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type memUser struct {
+	userID  string
+	login   string
+	hash    string
+	balanse money.Amount
+	roles   []string
+	tokens  int64 // поколение access-токенов
+}
+
+type memAccum struct {
+	userID string
+	order  string
+	sum    money.Amount
+	date   time.Time
+	status string
+}
+
+type memSubtract struct {
+	userID string
+	order  string
+	sum    money.Amount
+	date   time.Time
+	status string
+}
+
+// Memory — потокобезопасное хранилище в памяти для тестов и демонстраций
+// без PostgreSQL. Повторяет ограничения таблиц users, accum и subtract.
+type Memory struct {
+	mu  sync.RWMutex
+	cfg config.Config
+
+	users     map[string]*memUser // по логину в нижнем регистре
+	usersByID map[string]*memUser
+	accum     map[string]*memAccum // по номеру заказа
+	accumList []*memAccum          // в порядке загрузки
+	subtract  map[string]*memSubtract
+	subList   []*memSubtract
+	ledger    []Posting
+	idemKeys  map[memIdemKey]memSubtract
+	queue     map[string]*memQueued
+	sessions  map[string]*Session
+	refresh   map[string]*memRefresh // по хешу токена
+	attempts  map[memAttemptKey]*memAttempts
+	resets    map[string]*memReset // по хешу токена
+	totp      map[string]*TOTP
+	recovery  map[string]map[string]bool // userID -> хеш кода -> использован
+}
+
+type memReset struct {
+	PasswordReset
+	used bool
+}
+
+type memAttemptKey struct {
+	scope string
+	key   string
+}
+
+type memAttempts struct {
+	LoginAttempts
+	lastFailure time.Time
+}
+
+type memRefresh struct {
+	RefreshToken
+	spent bool // использован или отозван
+}
+
+type memQueued struct {
+	order       string
+	nextAttempt time.Time
+	attempts    int
+	lockedBy    string
+	lockedUntil time.Time
+}
+
+type memIdemKey struct {
+	userID string
+	key    string
+}
+
+func NewMemory(cfg config.Config) *Memory {
+	return &Memory{
+		cfg:       cfg,
+		users:     make(map[string]*memUser),
+		usersByID: make(map[string]*memUser),
+		accum:     make(map[string]*memAccum),
+		subtract:  make(map[string]*memSubtract),
+		idemKeys:  make(map[memIdemKey]memSubtract),
+		queue:     make(map[string]*memQueued),
+		sessions:  make(map[string]*Session),
+		refresh:   make(map[string]*memRefresh),
+		attempts:  make(map[memAttemptKey]*memAttempts),
+		resets:    make(map[string]*memReset),
+		totp:      make(map[string]*TOTP),
+		recovery:  make(map[string]map[string]bool),
+	}
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) WriteNewUser(ctx context.Context, login string, hash string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// как users_login_lower в PostgreSQL: логин без учёта регистра
+	if _, ok := m.users[strings.ToLower(login)]; ok {
+		return "", ErrDuplicate
+	}
+
+	user := &memUser{
+		userID: uuid.New().String(),
+		login:  login,
+		hash:   hash,
+	}
+	m.users[strings.ToLower(login)] = user
+	m.usersByID[user.userID] = user
+
+	return user.userID, nil
+}
+
+func (m *Memory) ReadUser(ctx context.Context, login string) (userID string, hash string, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[strings.ToLower(login)]
+	if !ok {
+		return "", "", nil
+	}
+	return user.userID, user.hash, nil
+}
+
+func (m *Memory) ReadUserByID(ctx context.Context, userID string) (login string, hash string, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.usersByID[userID]
+	if !ok {
+		return "", "", nil
+	}
+	return user.login, user.hash, nil
+}
+
+func (m *Memory) CreatePasswordReset(ctx context.Context, reset PasswordReset) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.resets[reset.Hash]; ok {
+		return ErrDuplicate
+	}
+	m.resets[reset.Hash] = &memReset{PasswordReset: reset}
+	return nil
+}
+
+func (m *Memory) GetPasswordReset(ctx context.Context, hash string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if item, ok := m.resets[hash]; ok && !item.used && time.Now().Before(item.ExpiresAt) {
+		return item.UserID, nil
+	}
+	return "", nil
+}
+
+func (m *Memory) ResetPassword(ctx context.Context, hash string, passwordHash string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.resets[hash]
+	if !ok || item.used || !time.Now().Before(item.ExpiresAt) {
+		return "", nil
+	}
+	for _, other := range m.resets {
+		if other.UserID == item.UserID {
+			other.used = true
+		}
+	}
+	if user, ok := m.usersByID[item.UserID]; ok {
+		user.hash = passwordHash
+	}
+	return item.UserID, nil
+}
+
+func (m *Memory) GetTOTP(ctx context.Context, userID string) (TOTP, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if item, ok := m.totp[userID]; ok {
+		return *item, nil
+	}
+	return TOTP{}, nil
+}
+
+func (m *Memory) SetTOTPSecret(ctx context.Context, userID string, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if item, ok := m.totp[userID]; ok && item.Enabled {
+		return ErrDuplicate
+	}
+	m.totp[userID] = &TOTP{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (m *Memory) EnableTOTP(ctx context.Context, userID string, step int64, codeHashes []string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.totp[userID]
+	if !ok || item.Enabled {
+		return false, nil
+	}
+	item.Enabled = true
+	item.LastStep = step
+	m.replaceRecoveryCodes(userID, codeHashes)
+	return true, nil
+}
+
+func (m *Memory) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.totp[userID]
+	if !ok || !item.Enabled || item.LastStep >= step {
+		return false, nil
+	}
+	item.LastStep = step
+	return true, nil
+}
+
+func (m *Memory) UseRecoveryCode(ctx context.Context, userID string, codeHash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used, ok := m.recovery[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	m.recovery[userID][codeHash] = true
+	return true, nil
+}
+
+func (m *Memory) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+func (m *Memory) replaceRecoveryCodes(userID string, codeHashes []string) {
+	codes := make(map[string]bool, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes[hash] = false
+	}
+	m.recovery[userID] = codes
+}
+
+func (m *Memory) DeleteTOTP(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.totp, userID)
+	delete(m.recovery, userID)
+	return nil
+}
+
+func (m *Memory) UpdatePasswordHash(ctx context.Context, userID string, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.usersByID[userID]; ok {
+		user.hash = hash
+	}
+	return nil
+}
+
+func (m *Memory) ExistsUserID(ctx context.Context, userID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.usersByID[userID]
+	return ok, nil
+}
+
+func (m *Memory) CreateSession(ctx context.Context, session Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, item := range m.sessions {
+		if item.UserID == session.UserID && item.ExpiresAt.Before(now) {
+			delete(m.sessions, id)
+		}
+	}
+
+	if _, ok := m.sessions[session.ID]; ok {
+		return ErrDuplicate
+	}
+	m.sessions[session.ID] = &session
+	return nil
+}
+
+func (m *Memory) GetSession(ctx context.Context, sessionID string) (Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if item, ok := m.sessions[sessionID]; ok {
+		return *item, nil
+	}
+	return Session{}, nil
+}
+
+func (m *Memory) RevokeSession(ctx context.Context, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if item, ok := m.sessions[sessionID]; ok {
+		item.Revoked = true
+	}
+	return nil
+}
+
+func (m *Memory) RevokeUserSessions(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, item := range m.sessions {
+		if item.UserID == userID {
+			item.Revoked = true
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetTokenGeneration(ctx context.Context, userID string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if user, ok := m.usersByID[userID]; ok {
+		return user.tokens, nil
+	}
+	return 0, nil
+}
+
+func (m *Memory) BumpTokenGeneration(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.usersByID[userID]; ok {
+		user.tokens++
+	}
+	return nil
+}
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.refresh[token.Hash]; ok {
+		return ErrDuplicate
+	}
+	m.refresh[token.Hash] = &memRefresh{RefreshToken: token}
+	return nil
+}
+
+func (m *Memory) RotateRefreshToken(ctx context.Context, hash string, next RefreshToken) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.refresh[hash]
+	switch {
+	case !ok:
+		return RefreshToken{}, nil
+	case old.spent:
+		m.revokeFamily(old.FamilyID)
+		for _, item := range m.refresh {
+			if session, ok := m.sessions[item.SessionID]; ok && item.FamilyID == old.FamilyID {
+				session.Revoked = true
+			}
+		}
+		return old.RefreshToken, ErrRefreshReused
+	case !time.Now().Before(old.ExpiresAt):
+		return RefreshToken{}, nil
+	}
+
+	if _, ok := m.refresh[next.Hash]; ok {
+		return RefreshToken{}, ErrDuplicate
+	}
+	old.spent = true
+	if session, ok := m.sessions[old.SessionID]; ok {
+		session.Revoked = true
+	}
+	next.FamilyID = old.FamilyID
+	next.UserID = old.UserID
+	m.refresh[next.Hash] = &memRefresh{RefreshToken: next}
+
+	return old.RefreshToken, nil
+}
+
+func (m *Memory) RevokeRefreshFamily(ctx context.Context, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if item, ok := m.refresh[hash]; ok {
+		m.revokeFamily(item.FamilyID)
+	}
+	return nil
+}
+
+func (m *Memory) revokeFamily(familyID string) {
+	for _, item := range m.refresh {
+		if item.FamilyID == familyID {
+			item.spent = true
+		}
+	}
+}
+
+func (m *Memory) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, item := range m.refresh {
+		if item.UserID == userID {
+			item.spent = true
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetRoles(ctx context.Context, userID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if user, ok := m.usersByID[userID]; ok {
+		return append([]string(nil), user.roles...), nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) GrantRole(ctx context.Context, userID string, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.usersByID[userID]
+	if !ok {
+		return nil
+	}
+	for _, item := range user.roles {
+		if item == role {
+			return nil
+		}
+	}
+	user.roles = append(user.roles, role)
+	sort.Strings(user.roles)
+	return nil
+}
+
+func (m *Memory) RevokeRole(ctx context.Context, userID string, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.usersByID[userID]
+	if !ok {
+		return nil
+	}
+	var roles []string
+	for _, item := range user.roles {
+		if item != role {
+			roles = append(roles, item)
+		}
+	}
+	user.roles = roles
+	return nil
+}
+
+func (m *Memory) ReserveLoginAttempt(ctx context.Context, scope string, key string, now time.Time, since time.Time, lockFor func(failures int) time.Duration) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := memAttemptKey{scope: scope, key: key}
+	item, ok := m.attempts[id]
+	if !ok {
+		item = &memAttempts{lastFailure: now}
+		m.attempts[id] = item
+	}
+	if item.LockedUntil.After(now) {
+		return item.LockedUntil, nil
+	}
+
+	if item.lastFailure.Before(since) {
+		item.Failures = 0
+	}
+	item.Failures++
+	item.lastFailure = now
+	item.LockedUntil = time.Time{}
+	if lock := lockFor(item.Failures); lock > 0 {
+		item.LockedUntil = now.Add(lock)
+	}
+
+	return time.Time{}, nil
+}
+
+func (m *Memory) ReleaseLoginAttempt(ctx context.Context, scope string, key string, lockFor func(failures int) time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.attempts[memAttemptKey{scope: scope, key: key}]
+	if !ok {
+		return nil
+	}
+	if item.Failures > 0 {
+		item.Failures--
+	}
+	if lockFor(item.Failures) == 0 {
+		item.LockedUntil = time.Time{}
+	}
+	return nil
+}
+
+func (m *Memory) ClearLoginAttempts(ctx context.Context, scope string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, memAttemptKey{scope: scope, key: key})
+	return nil
+}
+
+func (m *Memory) GetBalanseSpent(ctx context.Context, userID string) (balance money.Amount, spent money.Amount, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.balanseSpent(userID)
+}
+
+func (m *Memory) balanseSpent(userID string) (balance money.Amount, spent money.Amount, err error) {
+	user, ok := m.usersByID[userID]
+	if !ok {
+		return 0, 0, errNotFound
+	}
+	for _, item := range m.subList {
+		if item.userID == userID && item.status != WithdrawalReversed {
+			spent += item.sum
+		}
+	}
+	return user.balanse, spent, nil
+}
+
+func (m *Memory) AddOrder(ctx context.Context, order string, userID string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.accum[order]
+	switch {
+	case !ok:
+		item = &memAccum{
+			userID: userID,
+			order:  order,
+			date:   time.Now(),
+			status: m.cfg.OrdersStatus.New,
+		}
+		m.accum[order] = item
+		m.accumList = append(m.accumList, item)
+		m.queue[order] = &memQueued{order: order, nextAttempt: item.date}
+		return http.StatusAccepted
+	case item.userID != userID:
+		return http.StatusConflict
+	default:
+		return http.StatusOK
+	}
+}
+
+func (m *Memory) GetAccum(ctx context.Context, userID string, filter ListFilter) ([]config.OutAccum, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out []config.OutAccum
+	for _, item := range m.accumList {
+		if item.userID != userID || !filter.match(item.date, item.order, item.status) {
+			continue
+		}
+		out = append(out, config.OutAccum{
+			Order:  item.order,
+			Status: item.status,
+			Sum:    item.sum,
+			Date:   item.date,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return listLess(out[i].Date, out[i].Order, out[j].Date, out[j].Order) })
+
+	if filter.Limit > 0 && len(out) > filter.Limit {
+		out = out[:filter.Limit]
+	}
+	return out, nil
+}
+
+func (m *Memory) WriteWithdraw(ctx context.Context, order string, sum money.Amount, userID string, idempotencyKey string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := memIdemKey{userID: userID, key: idempotencyKey}
+	if done, ok := m.idemKeys[key]; ok && idempotencyKey != "" {
+		if done.order != order || done.sum != sum {
+			return http.StatusUnprocessableEntity
+		}
+		return http.StatusOK
+	}
+
+	balance, _, err := m.balanseSpent(userID)
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+
+	if balance < sum {
+		return http.StatusPaymentRequired
+	}
+
+	if _, ok := m.subtract[order]; ok {
+		return http.StatusInternalServerError
+	}
+
+	item := &memSubtract{
+		userID: userID,
+		order:  order,
+		sum:    sum,
+		date:   time.Now(),
+		status: WithdrawalCompleted,
+	}
+	m.subtract[order] = item
+	m.subList = append(m.subList, item)
+	m.post(KindWithdrawal, userID, -sum, AccountWithdrawal, order, "")
+	if idempotencyKey != "" {
+		m.idemKeys[key] = *item
+	}
+
+	return http.StatusOK
+}
+
+func (m *Memory) GetWithdrawals(ctx context.Context, userID string, filter ListFilter) ([]config.OutWithdrawals, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out []config.OutWithdrawals
+	for _, item := range m.subList {
+		if item.userID != userID || !filter.match(item.date, item.order, item.status) {
+			continue
+		}
+		out = append(out, config.OutWithdrawals{
+			Order:  item.order,
+			Sum:    item.sum,
+			Date:   item.date,
+			Status: item.status,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return listLess(out[i].Date, out[i].Order, out[j].Date, out[j].Order) })
+
+	if filter.Limit > 0 && len(out) > filter.Limit {
+		out = out[:filter.Limit]
+	}
+	return out, nil
+}
+
+// listLess — порядок списков: по дате, затем по номеру заказа.
+func listLess(date1 time.Time, order1 string, date2 time.Time, order2 string) bool {
+	if !date1.Equal(date2) {
+		return date1.Before(date2)
+	}
+	return order1 < order2
+}
+
+func (m *Memory) GetUserID(ctx context.Context, order string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if item, ok := m.accum[order]; ok {
+		return item.userID, nil
+	}
+	return "", nil
+}
+
+func (m *Memory) LeaseOrders(ctx context.Context, workerID string, limit int, lease time.Duration) ([]QueuedOrder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	var due []*memQueued
+	for _, item := range m.queue {
+		if !item.nextAttempt.After(now) && (item.lockedUntil.IsZero() || item.lockedUntil.Before(now)) {
+			due = append(due, item)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].nextAttempt.Before(due[j].nextAttempt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	var out []QueuedOrder
+	for _, item := range due {
+		item.lockedBy = workerID
+		item.lockedUntil = now.Add(lease)
+		item.attempts++
+		out = append(out, QueuedOrder{Order: item.order, Attempts: item.attempts})
+	}
+
+	return out, nil
+}
+
+func (m *Memory) RescheduleOrder(ctx context.Context, workerID string, order string, delay time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if item, ok := m.queue[order]; ok && item.lockedBy == workerID {
+		item.nextAttempt = time.Now().Add(delay)
+		item.lockedBy = ""
+		item.lockedUntil = time.Time{}
+	}
+	return nil
+}
+
+func (m *Memory) UpdateOrder(ctx context.Context, order string, status string, sum money.Amount, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.accum[order]
+	if !ok {
+		return nil
+	}
+
+	statuses := m.cfg.OrdersStatus
+	if item.status == statuses.Processed || item.status == statuses.Invalid {
+		return nil
+	}
+
+	item.status = status
+	if status == statuses.Processed {
+		item.sum = sum
+		if _, ok := m.usersByID[userID]; ok && sum > 0 {
+			m.post(KindAccrual, userID, sum, AccountAccrual, order, "")
+		}
+	}
+	if status == statuses.Processed || status == statuses.Invalid {
+		delete(m.queue, order)
+	}
+
+	return nil
+}
+
+// post — аналог postEntry; вызывается под m.mu.
+func (m *Memory) post(kind string, userID string, amount money.Amount, counter string, order string, comment string) string {
+	entryID := uuid.New().String()
+	now := time.Now()
+
+	m.appendPosting(Posting{EntryID: entryID, Account: UserAccount(userID), Kind: kind, Amount: amount, Order: order, Comment: comment, Date: now})
+	m.appendPosting(Posting{EntryID: entryID, Account: counter, Kind: kind, Amount: -amount, Order: order, Comment: comment, Date: now})
+	m.usersByID[userID].balanse += amount
+
+	return entryID
+}
+
+func (m *Memory) appendPosting(item Posting) {
+	item.ID = int64(len(m.ledger) + 1)
+	m.ledger = append(m.ledger, item)
+}
+
+func (m *Memory) PostAdjustment(ctx context.Context, userID string, amount money.Amount, comment string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.usersByID[userID]; !ok {
+		return "", errNotFound
+	}
+	return m.post(KindAdjustment, userID, amount, AccountAdjustment, "", comment), nil
+}
+
+func (m *Memory) ReverseEntry(ctx context.Context, entryID string, comment string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var postings []Posting
+	for _, item := range m.ledger {
+		if item.Reverses == entryID {
+			return "", errReversed
+		}
+		if item.EntryID == entryID {
+			postings = append(postings, item)
+		}
+	}
+	if len(postings) == 0 {
+		return "", errNotFound
+	}
+	if postings[0].Kind == KindReversal {
+		return "", errReversed
+	}
+
+	reversalID := uuid.New().String()
+	now := time.Now()
+	for _, item := range postings {
+		m.appendPosting(Posting{
+			EntryID:  reversalID,
+			Account:  item.Account,
+			Kind:     KindReversal,
+			Amount:   -item.Amount,
+			Order:    item.Order,
+			Reverses: entryID,
+			Comment:  comment,
+			Date:     now,
+		})
+		for _, user := range m.usersByID {
+			if UserAccount(user.userID) == item.Account {
+				user.balanse -= item.Amount
+			}
+		}
+	}
+
+	if item, ok := m.subtract[postings[0].Order]; ok && postings[0].Kind == KindWithdrawal {
+		item.status = WithdrawalReversed
+	}
+
+	return reversalID, nil
+}
+
+func (m *Memory) GetLedger(ctx context.Context, userID string) ([]Posting, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out []Posting
+	for _, item := range m.ledger {
+		if item.Account == UserAccount(userID) {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) Reconcile(ctx context.Context) (Reconciliation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var out Reconciliation
+
+	accounts := make(map[string]money.Amount)
+	entries := make(map[string]money.Amount)
+	var entryOrder []string
+	for _, item := range m.ledger {
+		accounts[item.Account] += item.Amount
+		if _, ok := entries[item.EntryID]; !ok {
+			entryOrder = append(entryOrder, item.EntryID)
+		}
+		entries[item.EntryID] += item.Amount
+	}
+
+	for _, user := range m.usersByID {
+		ledger := accounts[UserAccount(user.userID)]
+		if user.balanse != ledger {
+			out.Drifts = append(out.Drifts, Drift{UserID: user.userID, Cached: user.balanse, Ledger: ledger})
+		}
+	}
+	for _, entryID := range entryOrder {
+		if entries[entryID] != 0 {
+			out.Unbalanced = append(out.Unbalanced, entryID)
+		}
+	}
+
+	return out, nil
+}
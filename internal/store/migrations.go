@@ -0,0 +1,25 @@
+package store
+
+import (
+	"database/sql"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/migrate"
+	"embed"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Open открывает соединение с PostgreSQL без применения миграций.
+func Open(cfg config.Config) (*sql.DB, error) {
+	return sql.Open("pgx", cfg.DataBase)
+}
+
+// NewMigrator возвращает мигратор со встроенными миграциями схемы.
+func NewMigrator(db *sql.DB) (*migrate.Migrator, error) {
+	migrations, err := migrate.Load(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(db, migrations), nil
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS subtract;
+DROP TABLE IF EXISTS accum;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,22 @@
+-- исходная схема; IF NOT EXISTS — чтобы принять базы, созданные до миграций
+CREATE TABLE IF NOT EXISTS users(
+	"userID" TEXT,
+	"login" TEXT PRIMARY KEY,
+	"hash" TEXT,
+	"balanse" FLOAT
+);
+
+CREATE TABLE IF NOT EXISTS accum(
+	"userID" TEXT,
+	"order" TEXT PRIMARY KEY,
+	"sum" FLOAT,
+	"date" DATE,
+	"status" TEXT
+);
+
+CREATE TABLE IF NOT EXISTS subtract(
+	"userID" TEXT,
+	"order" TEXT PRIMARY KEY,
+	"sum" FLOAT,
+	"date" DATE
+);
@@ -0,0 +1,41 @@
+-- журнал проводок по двойной записи: каждая запись (entryID) — это
+-- минимум две проводки с нулевой суммой; счёт пользователя — 'user:<userID>'
+CREATE TABLE ledger(
+	"id" BIGSERIAL PRIMARY KEY,
+	"entryID" UUID NOT NULL,
+	"account" TEXT NOT NULL,
+	"kind" TEXT NOT NULL,
+	"amount" NUMERIC(14,2) NOT NULL,
+	"order" TEXT,
+	"reverses" UUID,
+	"comment" TEXT,
+	"date" TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX ledger_account ON ledger ("account");
+CREATE INDEX ledger_entry ON ledger ("entryID");
+-- запись можно сторнировать только один раз
+CREATE UNIQUE INDEX ledger_reverses ON ledger ("reverses", "account") WHERE "reverses" IS NOT NULL;
+
+CREATE FUNCTION ledger_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'ledger is append-only';
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_append_only BEFORE UPDATE OR DELETE ON ledger
+	FOR EACH ROW EXECUTE PROCEDURE ledger_append_only();
+
+-- перенос истории: начисления по обработанным заказам и списания
+INSERT INTO ledger ("entryID", "account", "kind", "amount", "order", "date")
+SELECT md5('accrual:' || "order")::uuid, 'user:' || "userID", 'accrual', "sum", "order", "date"
+FROM accum WHERE "status" = 'PROCESSED' AND "sum" > 0
+UNION ALL
+SELECT md5('accrual:' || "order")::uuid, 'system:accrual', 'accrual', -"sum", "order", "date"
+FROM accum WHERE "status" = 'PROCESSED' AND "sum" > 0
+UNION ALL
+SELECT md5('withdrawal:' || "order")::uuid, 'user:' || "userID", 'withdrawal', -"sum", "order", "date"
+FROM subtract
+UNION ALL
+SELECT md5('withdrawal:' || "order")::uuid, 'system:withdrawal', 'withdrawal', "sum", "order", "date"
+FROM subtract;
@@ -0,0 +1,4 @@
+ALTER TABLE subtract ALTER COLUMN "sum" TYPE FLOAT;
+ALTER TABLE accum ALTER COLUMN "sum" TYPE FLOAT;
+ALTER TABLE users ALTER COLUMN "balanse" DROP DEFAULT;
+ALTER TABLE users ALTER COLUMN "balanse" TYPE FLOAT;
@@ -0,0 +1,5 @@
+-- суммы в баллах хранятся точно, до сотых
+ALTER TABLE users ALTER COLUMN "balanse" TYPE NUMERIC(14,2) USING round("balanse"::numeric, 2);
+ALTER TABLE users ALTER COLUMN "balanse" SET DEFAULT 0;
+ALTER TABLE accum ALTER COLUMN "sum" TYPE NUMERIC(14,2) USING round("sum"::numeric, 2);
+ALTER TABLE subtract ALTER COLUMN "sum" TYPE NUMERIC(14,2) USING round("sum"::numeric, 2);
@@ -0,0 +1,9 @@
+-- ключи идемпотентности успешных списаний (заголовок Idempotency-Key)
+CREATE TABLE idempotency_keys(
+	"userID" TEXT NOT NULL,
+	"key" TEXT NOT NULL,
+	"order" TEXT NOT NULL,
+	"sum" NUMERIC(14,2) NOT NULL,
+	"date" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY ("userID", "key")
+);
@@ -0,0 +1,13 @@
+-- очередь заказов, ожидающих расчёта; заказ в ней до окончательного статуса
+CREATE TABLE order_queue(
+	"order" TEXT PRIMARY KEY REFERENCES accum ("order") ON DELETE CASCADE,
+	"next_attempt_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"attempts" INTEGER NOT NULL DEFAULT 0,
+	"locked_by" TEXT,
+	"locked_until" TIMESTAMPTZ
+);
+
+CREATE INDEX order_queue_next_attempt ON order_queue ("next_attempt_at");
+
+INSERT INTO order_queue ("order")
+SELECT "order" FROM accum WHERE "status" NOT IN ('PROCESSED', 'INVALID');
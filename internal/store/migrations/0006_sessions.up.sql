@@ -0,0 +1,10 @@
+-- сессии пользователей; в cookie — подписанный "sessionID"
+CREATE TABLE sessions(
+	"sessionID" TEXT PRIMARY KEY,
+	"userID" TEXT NOT NULL,
+	"created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"expires_at" TIMESTAMPTZ NOT NULL,
+	"revoked_at" TIMESTAMPTZ
+);
+
+CREATE INDEX sessions_user ON sessions ("userID");
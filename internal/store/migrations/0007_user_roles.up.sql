@@ -0,0 +1,6 @@
+-- роли пользователей сверх роли user, которая есть у всех
+CREATE TABLE user_roles(
+	"userID" TEXT NOT NULL,
+	"role" TEXT NOT NULL,
+	PRIMARY KEY ("userID", "role")
+);
@@ -0,0 +1,14 @@
+-- refresh-токены хранятся хешем (sha256); токены одной цепочки обновлений
+-- образуют семейство, повтор использованного токена отзывает всё семейство
+CREATE TABLE refresh_tokens(
+	"tokenHash" TEXT PRIMARY KEY,
+	"familyID" TEXT NOT NULL,
+	"userID" TEXT NOT NULL,
+	"created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"expires_at" TIMESTAMPTZ NOT NULL,
+	"used_at" TIMESTAMPTZ,
+	"revoked_at" TIMESTAMPTZ
+);
+
+CREATE INDEX refresh_tokens_family ON refresh_tokens ("familyID");
+CREATE INDEX refresh_tokens_user ON refresh_tokens ("userID");
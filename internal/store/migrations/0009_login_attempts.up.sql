@@ -0,0 +1,9 @@
+-- неудачные попытки входа по логину (scope = 'login') и по IP (scope = 'ip')
+CREATE TABLE login_attempts(
+	"scope" TEXT NOT NULL,
+	"key" TEXT NOT NULL,
+	"failures" INTEGER NOT NULL DEFAULT 0,
+	"last_failure" TIMESTAMPTZ NOT NULL,
+	"locked_until" TIMESTAMPTZ,
+	PRIMARY KEY ("scope", "key")
+);
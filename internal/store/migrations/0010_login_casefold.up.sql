@@ -0,0 +1,4 @@
+-- логины без учёта регистра: "Bob" и "bob" — один логин.
+-- Если в базе уже есть такие пары, миграция не пройдёт; найти их:
+--   SELECT lower("login") FROM users GROUP BY 1 HAVING count(*) > 1;
+CREATE UNIQUE INDEX users_login_lower ON users (lower("login"));
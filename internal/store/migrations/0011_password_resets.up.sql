@@ -0,0 +1,10 @@
+-- одноразовые токены сброса пароля; хранится только хеш токена
+CREATE TABLE password_resets(
+	"tokenHash" TEXT PRIMARY KEY,
+	"userID" TEXT NOT NULL,
+	"created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"expires_at" TIMESTAMPTZ NOT NULL,
+	"used_at" TIMESTAMPTZ
+);
+
+CREATE INDEX password_resets_user ON password_resets ("userID");
@@ -0,0 +1,16 @@
+-- второй фактор входа: секрет TOTP (зашифрован) и одноразовые коды восстановления
+CREATE TABLE user_totp(
+	"userID" TEXT PRIMARY KEY,
+	"secret" TEXT NOT NULL,
+	"enabled" BOOLEAN NOT NULL DEFAULT false,
+	"last_step" BIGINT NOT NULL DEFAULT 0,
+	"created_at" TIMESTAMPTZ NOT NULL DEFAULT now(),
+	"enabled_at" TIMESTAMPTZ
+);
+
+CREATE TABLE recovery_codes(
+	"userID" TEXT NOT NULL,
+	"codeHash" TEXT NOT NULL,
+	"used_at" TIMESTAMPTZ,
+	PRIMARY KEY ("userID", "codeHash")
+);
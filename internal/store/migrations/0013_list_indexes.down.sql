@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS subtract_user_date;
+DROP INDEX IF EXISTS accum_user_date;
@@ -0,0 +1,3 @@
+-- постраничная выдача заказов и списаний пользователя: курсор по ("date", "order")
+CREATE INDEX accum_user_date ON accum ("userID", "date", "order");
+CREATE INDEX subtract_user_date ON subtract ("userID", "date", "order");
@@ -0,0 +1 @@
+ALTER TABLE subtract DROP COLUMN IF EXISTS "status";
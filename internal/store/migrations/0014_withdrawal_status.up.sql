@@ -0,0 +1,3 @@
+-- статус списания; записанные до миграции списания проведены
+ALTER TABLE subtract ADD COLUMN "status" TEXT NOT NULL DEFAULT 'completed'
+	CHECK ("status" IN ('pending', 'completed', 'reversed'));
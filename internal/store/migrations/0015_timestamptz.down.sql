@@ -0,0 +1,4 @@
+ALTER TABLE subtract ALTER COLUMN "date" DROP DEFAULT;
+ALTER TABLE subtract ALTER COLUMN "date" TYPE DATE USING ("date" AT TIME ZONE 'UTC')::date;
+ALTER TABLE accum ALTER COLUMN "date" DROP DEFAULT;
+ALTER TABLE accum ALTER COLUMN "date" TYPE DATE USING ("date" AT TIME ZONE 'UTC')::date;
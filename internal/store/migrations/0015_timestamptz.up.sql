@@ -0,0 +1,6 @@
+-- время загрузки заказа и списания с точностью до микросекунд; записанные
+-- раньше даты становятся полуночью UTC того же дня
+ALTER TABLE accum ALTER COLUMN "date" TYPE TIMESTAMPTZ USING ("date"::timestamp AT TIME ZONE 'UTC');
+ALTER TABLE accum ALTER COLUMN "date" SET DEFAULT now();
+ALTER TABLE subtract ALTER COLUMN "date" TYPE TIMESTAMPTZ USING ("date"::timestamp AT TIME ZONE 'UTC');
+ALTER TABLE subtract ALTER COLUMN "date" SET DEFAULT now();
@@ -0,0 +1,3 @@
+-- поколение токенов пользователя: access-токены JWT несут его в "gen",
+-- и отзыв (выход, смена пароля) увеличивает его, гася выданные токены
+ALTER TABLE users ADD COLUMN "token_generation" BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- сессия, открытая вместе с refresh-токеном: обмен токена закрывает её,
+-- а повтор использованного токена — все сессии семейства
+ALTER TABLE refresh_tokens ADD COLUMN "sessionID" TEXT;
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// QueuedOrder — заказ, выданный обработчику из очереди расчёта.
+type QueuedOrder struct {
+	Order    string
+	Attempts int // номер текущей попытки, начиная с 1
+}
+
+func enqueueOrder(ctx context.Context, db execer, order string) error {
+	textInsert := `INSERT INTO order_queue ("order") VALUES ($1) ON CONFLICT DO NOTHING`
+	_, err := db.ExecContext(ctx, textInsert, order)
+	return err
+}
+
+// LeaseOrders выдаёт обработчику workerID до limit заказов, срок очередной
+// попытки которых наступил, и закрепляет их за ним на lease. Заказы,
+// закреплённые за другими обработчиками (в том числе других реплик),
+// пропускаются (SKIP LOCKED); незавершённая аренда истекает сама.
+func (s *DB) LeaseOrders(ctx context.Context, workerID string, limit int, lease time.Duration) ([]QueuedOrder, error) {
+
+	textQuery := `UPDATE order_queue q
+	SET "locked_by" = $1, "locked_until" = now() + make_interval(secs => $3), "attempts" = q."attempts" + 1
+	FROM (
+		SELECT "order" FROM order_queue
+		WHERE "next_attempt_at" <= now() AND ("locked_until" IS NULL OR "locked_until" < now())
+		ORDER BY "next_attempt_at"
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	) due
+	WHERE q."order" = due."order"
+	RETURNING q."order", q."attempts"`
+
+	rows, err := s.db.QueryContext(ctx, textQuery, workerID, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []QueuedOrder
+	for rows.Next() {
+		var item QueuedOrder
+		if err := rows.Scan(&item.Order, &item.Attempts); err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+
+	return out, rows.Err()
+}
+
+// RescheduleOrder снимает аренду и назначает следующую попытку через delay.
+func (s *DB) RescheduleOrder(ctx context.Context, workerID string, order string, delay time.Duration) error {
+
+	textUpdate := `UPDATE order_queue
+	SET "next_attempt_at" = now() + make_interval(secs => $3), "locked_by" = NULL, "locked_until" = NULL
+	WHERE "order" = $1 AND "locked_by" = $2`
+
+	_, err := s.db.ExecContext(ctx, textUpdate, order, workerID, delay.Seconds())
+	return err
+}
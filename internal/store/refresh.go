@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrRefreshReused — предъявлен уже использованный или отозванный
+// refresh-токен; его семейство отозвано.
+var ErrRefreshReused = errors.New("refresh token reused")
+
+// RefreshToken — refresh-токен; сам токен не хранится, только его хеш.
+type RefreshToken struct {
+	Hash      string
+	FamilyID  string
+	UserID    string
+	SessionID string // сессия, открытая вместе с токеном
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+func (s *DB) CreateRefreshToken(ctx context.Context, token RefreshToken) error {
+
+	textInsert := `
+	INSERT INTO refresh_tokens ("tokenHash", "familyID", "userID", "sessionID", "created_at", "expires_at")
+	VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := s.db.ExecContext(ctx, textInsert, token.Hash, token.FamilyID, token.UserID, token.SessionID, token.CreatedAt, token.ExpiresAt)
+	return err
+}
+
+// RotateRefreshToken обменивает действующий токен hash на next того же
+// семейства и пользователя, отзывает сессию старого токена и возвращает
+// старый токен. Для неизвестного или истёкшего токена возвращает пустой
+// RefreshToken. Повтор использованного или отозванного токена отзывает всё
+// семейство с его сессиями и возвращает старый токен с ErrRefreshReused.
+func (s *DB) RotateRefreshToken(ctx context.Context, hash string, next RefreshToken) (RefreshToken, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	var (
+		old     = RefreshToken{Hash: hash}
+		spent   bool
+		expired bool
+	)
+
+	// блокировка строки: параллельные обмены одного токена сериализуются,
+	// второй увидит used_at и сочтёт обмен повтором
+	textQuery := `SELECT "familyID", "userID", COALESCE("sessionID", ''), "created_at", "expires_at",
+	"used_at" IS NOT NULL OR "revoked_at" IS NOT NULL, "expires_at" <= now()
+	FROM refresh_tokens WHERE "tokenHash" = $1 FOR UPDATE`
+	err = tx.QueryRowContext(ctx, textQuery, hash).
+		Scan(&old.FamilyID, &old.UserID, &old.SessionID, &old.CreatedAt, &old.ExpiresAt, &spent, &expired)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return RefreshToken{}, nil
+	case err != nil:
+		return RefreshToken{}, err
+	case spent:
+		textUpdate := `UPDATE refresh_tokens SET "revoked_at" = now() WHERE "familyID" = $1 AND "revoked_at" IS NULL`
+		if _, err := tx.ExecContext(ctx, textUpdate, old.FamilyID); err != nil {
+			return RefreshToken{}, err
+		}
+		textUpdate = `UPDATE sessions SET "revoked_at" = now()
+		WHERE "sessionID" IN (SELECT "sessionID" FROM refresh_tokens WHERE "familyID" = $1)
+		AND "revoked_at" IS NULL`
+		if _, err := tx.ExecContext(ctx, textUpdate, old.FamilyID); err != nil {
+			return RefreshToken{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return RefreshToken{}, err
+		}
+		return old, ErrRefreshReused
+	case expired:
+		return RefreshToken{}, nil
+	}
+
+	textUpdate := `UPDATE refresh_tokens SET "used_at" = now() WHERE "tokenHash" = $1`
+	if _, err := tx.ExecContext(ctx, textUpdate, hash); err != nil {
+		return RefreshToken{}, err
+	}
+	textUpdate = `UPDATE sessions SET "revoked_at" = now() WHERE "sessionID" = $1 AND "revoked_at" IS NULL`
+	if _, err := tx.ExecContext(ctx, textUpdate, old.SessionID); err != nil {
+		return RefreshToken{}, err
+	}
+
+	next.FamilyID = old.FamilyID
+	next.UserID = old.UserID
+	textInsert := `
+	INSERT INTO refresh_tokens ("tokenHash", "familyID", "userID", "sessionID", "created_at", "expires_at")
+	VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.ExecContext(ctx, textInsert, next.Hash, next.FamilyID, next.UserID, next.SessionID, next.CreatedAt, next.ExpiresAt)
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	return old, tx.Commit()
+}
+
+// RevokeRefreshFamily отзывает семейство, которому принадлежит токен hash.
+func (s *DB) RevokeRefreshFamily(ctx context.Context, hash string) error {
+
+	textUpdate := `UPDATE refresh_tokens SET "revoked_at" = now()
+	WHERE "familyID" = (SELECT "familyID" FROM refresh_tokens WHERE "tokenHash" = $1)
+	AND "revoked_at" IS NULL`
+	_, err := s.db.ExecContext(ctx, textUpdate, hash)
+	return err
+}
+
+func (s *DB) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+
+	textUpdate := `UPDATE refresh_tokens SET "revoked_at" = now() WHERE "userID" = $1 AND "revoked_at" IS NULL`
+	_, err := s.db.ExecContext(ctx, textUpdate, userID)
+	return err
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PasswordReset — токен сброса пароля; сам токен не хранится, только хеш.
+type PasswordReset struct {
+	Hash      string
+	UserID    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+func (s *DB) CreatePasswordReset(ctx context.Context, reset PasswordReset) error {
+
+	textInsert := `
+	INSERT INTO password_resets ("tokenHash", "userID", "created_at", "expires_at")
+	VALUES ($1, $2, $3, $4)`
+	_, err := s.db.ExecContext(ctx, textInsert, reset.Hash, reset.UserID, reset.CreatedAt, reset.ExpiresAt)
+	return err
+}
+
+// GetPasswordReset возвращает пользователя по действующему (не
+// использованному и не истёкшему) токену или "".
+func (s *DB) GetPasswordReset(ctx context.Context, hash string) (string, error) {
+
+	var userID string
+
+	textQuery := `SELECT "userID" FROM password_resets
+	WHERE "tokenHash" = $1 AND "used_at" IS NULL AND "expires_at" > now()`
+	err := s.db.QueryRowContext(ctx, textQuery, hash).Scan(&userID)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return "", nil
+	case err != nil:
+		return "", err
+	default:
+		return userID, nil
+	}
+}
+
+// ResetPassword гасит действующий токен вместе со всеми остальными токенами
+// пользователя и записывает новый хеш пароля — одной транзакцией, поэтому
+// токен срабатывает один раз. Возвращает пользователя или "", если токен
+// не действует.
+func (s *DB) ResetPassword(ctx context.Context, hash string, passwordHash string) (string, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var userID string
+
+	textUpdate := `UPDATE password_resets SET "used_at" = now()
+	WHERE "tokenHash" = $1 AND "used_at" IS NULL AND "expires_at" > now()
+	RETURNING "userID"`
+	err = tx.QueryRowContext(ctx, textUpdate, hash).Scan(&userID)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+
+	textUpdate = `UPDATE password_resets SET "used_at" = now() WHERE "userID" = $1 AND "used_at" IS NULL`
+	if _, err := tx.ExecContext(ctx, textUpdate, userID); err != nil {
+		return "", err
+	}
+
+	textUpdate = `UPDATE users SET "hash" = $1 WHERE "userID" = $2`
+	if _, err := tx.ExecContext(ctx, textUpdate, passwordHash, userID); err != nil {
+		return "", err
+	}
+
+	return userID, tx.Commit()
+}
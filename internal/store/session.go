@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Session — сессия пользователя, открытая входом или регистрацией.
+type Session struct {
+	ID        string
+	UserID    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Revoked   bool
+}
+
+// Active — сессия не отозвана и не истекла к моменту now.
+func (s Session) Active(now time.Time) bool {
+	return s.ID != "" && !s.Revoked && now.Before(s.ExpiresAt)
+}
+
+// CreateSession записывает новую сессию и удаляет истёкшие сессии того же
+// пользователя.
+func (s *DB) CreateSession(ctx context.Context, session Session) error {
+
+	textDelete := `DELETE FROM sessions WHERE "userID" = $1 AND "expires_at" < now()`
+	if _, err := s.db.ExecContext(ctx, textDelete, session.UserID); err != nil {
+		return err
+	}
+
+	textInsert := `
+	INSERT INTO sessions ("sessionID", "userID", "created_at", "expires_at")
+	VALUES ($1, $2, $3, $4)`
+	_, err := s.db.ExecContext(ctx, textInsert, session.ID, session.UserID, session.CreatedAt, session.ExpiresAt)
+	return err
+}
+
+// GetSession возвращает сессию или пустую Session, если её нет.
+func (s *DB) GetSession(ctx context.Context, sessionID string) (Session, error) {
+
+	session := Session{ID: sessionID}
+
+	textQuery := `SELECT "userID", "created_at", "expires_at", "revoked_at" IS NOT NULL
+	FROM sessions WHERE "sessionID" = $1`
+	err := s.db.QueryRowContext(ctx, textQuery, sessionID).
+		Scan(&session.UserID, &session.CreatedAt, &session.ExpiresAt, &session.Revoked)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return Session{}, nil
+	case err != nil:
+		return Session{}, err
+	default:
+		return session, nil
+	}
+}
+
+func (s *DB) RevokeSession(ctx context.Context, sessionID string) error {
+
+	textUpdate := `UPDATE sessions SET "revoked_at" = now() WHERE "sessionID" = $1 AND "revoked_at" IS NULL`
+	_, err := s.db.ExecContext(ctx, textUpdate, sessionID)
+	return err
+}
+
+// RevokeUserSessions отзывает все сессии пользователя.
+func (s *DB) RevokeUserSessions(ctx context.Context, userID string) error {
+
+	textUpdate := `UPDATE sessions SET "revoked_at" = now() WHERE "userID" = $1 AND "revoked_at" IS NULL`
+	_, err := s.db.ExecContext(ctx, textUpdate, userID)
+	return err
+}
+
+// GetTokenGeneration — поколение access-токенов пользователя; токены
+// прежних поколений отозваны.
+func (s *DB) GetTokenGeneration(ctx context.Context, userID string) (int64, error) {
+
+	var generation int64
+
+	textQuery := `SELECT "token_generation" FROM users WHERE "userID" = $1`
+	err := s.db.QueryRowContext(ctx, textQuery, userID).Scan(&generation)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return generation, err
+}
+
+// BumpTokenGeneration отзывает все выданные access-токены пользователя.
+func (s *DB) BumpTokenGeneration(ctx context.Context, userID string) error {
+
+	textUpdate := `UPDATE users SET "token_generation" = "token_generation" + 1 WHERE "userID" = $1`
+	_, err := s.db.ExecContext(ctx, textUpdate, userID)
+	return err
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"context"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/money"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrDuplicate — запись с таким ключом уже есть (логин занят).
+var ErrDuplicate = errors.New("duplicate key")
+
+var (
+	errNotFound = errors.New("not found")
+	errReversed = errors.New("entry already reversed or is a reversal")
+)
+
+// Storage — хранилище данных гофермарта: пользователи, начисления,
+// списания и очередь заказов, ожидающих расчёта.
+type Storage interface {
+	// пользователи
+	WriteNewUser(ctx context.Context, login string, hash string) (string, error)
+	ReadUser(ctx context.Context, login string) (userID string, hash string, err error)
+	ReadUserByID(ctx context.Context, userID string) (login string, hash string, err error)
+	UpdatePasswordHash(ctx context.Context, userID string, hash string) error
+	ExistsUserID(ctx context.Context, userID string) (bool, error)
+	GetRoles(ctx context.Context, userID string) ([]string, error)
+	GrantRole(ctx context.Context, userID string, role string) error
+	RevokeRole(ctx context.Context, userID string, role string) error
+
+	// сброс пароля
+	CreatePasswordReset(ctx context.Context, reset PasswordReset) error
+	GetPasswordReset(ctx context.Context, hash string) (string, error)
+	ResetPassword(ctx context.Context, hash string, passwordHash string) (string, error)
+
+	// второй фактор
+	GetTOTP(ctx context.Context, userID string) (TOTP, error)
+	SetTOTPSecret(ctx context.Context, userID string, secret string) error
+	EnableTOTP(ctx context.Context, userID string, step int64, codeHashes []string) (bool, error)
+	UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID string, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+	DeleteTOTP(ctx context.Context, userID string) error
+
+	// неудачные попытки входа
+	ReserveLoginAttempt(ctx context.Context, scope string, key string, now time.Time, since time.Time, lockFor func(failures int) time.Duration) (time.Time, error)
+	ReleaseLoginAttempt(ctx context.Context, scope string, key string, lockFor func(failures int) time.Duration) error
+	ClearLoginAttempts(ctx context.Context, scope string, key string) error
+
+	// сессии
+	CreateSession(ctx context.Context, session Session) error
+	GetSession(ctx context.Context, sessionID string) (Session, error)
+	RevokeSession(ctx context.Context, sessionID string) error
+	RevokeUserSessions(ctx context.Context, userID string) error
+	GetTokenGeneration(ctx context.Context, userID string) (int64, error)
+	BumpTokenGeneration(ctx context.Context, userID string) error
+
+	// refresh-токены
+	CreateRefreshToken(ctx context.Context, token RefreshToken) error
+	RotateRefreshToken(ctx context.Context, hash string, next RefreshToken) (RefreshToken, error)
+	RevokeRefreshFamily(ctx context.Context, hash string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID string) error
+
+	// начисления
+	AddOrder(ctx context.Context, order string, userID string) int
+	GetAccum(ctx context.Context, userID string, filter ListFilter) ([]config.OutAccum, error)
+	GetBalanseSpent(ctx context.Context, userID string) (balance money.Amount, spent money.Amount, err error)
+
+	// списания
+	WriteWithdraw(ctx context.Context, order string, sum money.Amount, userID string, idempotencyKey string) int
+	GetWithdrawals(ctx context.Context, userID string, filter ListFilter) ([]config.OutWithdrawals, error)
+
+	// очередь обработки заказов
+	LeaseOrders(ctx context.Context, workerID string, limit int, lease time.Duration) ([]QueuedOrder, error)
+	RescheduleOrder(ctx context.Context, workerID string, order string, delay time.Duration) error
+	GetUserID(ctx context.Context, order string) (string, error)
+	UpdateOrder(ctx context.Context, order string, status string, sum money.Amount, userID string) error
+
+	// журнал проводок
+	PostAdjustment(ctx context.Context, userID string, amount money.Amount, comment string) (string, error)
+	ReverseEntry(ctx context.Context, entryID string, comment string) (string, error)
+	GetLedger(ctx context.Context, userID string) ([]Posting, error)
+	Reconcile(ctx context.Context) (Reconciliation, error)
+
+	Close() error
+}
+
+// New возвращает хранилище PostgreSQL по DATABASE_URI или, только с
+// STORAGE=memory, хранилище в памяти: без адреса базы сервис не стартует,
+// чтобы забытая переменная не обернулась потерей данных.
+func New(cfg config.Config) (Storage, error) {
+	if cfg.Storage == "memory" {
+		log.Println("storage: STORAGE=memory, all data is kept in memory and lost on restart")
+		return NewMemory(cfg), nil
+	}
+	if cfg.DataBase == "" {
+		return nil, errors.New("storage: DATABASE_URI is not set (STORAGE=memory runs without a database)")
+	}
+	return NewDB(cfg)
+}
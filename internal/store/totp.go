@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TOTP — второй фактор пользователя. Secret зашифрован (encryption.Seal);
+// пока Enabled = false, секрет выдан, но не подтверждён кодом. LastStep —
+// последний принятый шаг времени: код не принимается дважды.
+type TOTP struct {
+	UserID   string
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+// GetTOTP возвращает второй фактор пользователя или TOTP{}, если его нет.
+func (s *DB) GetTOTP(ctx context.Context, userID string) (TOTP, error) {
+
+	out := TOTP{UserID: userID}
+
+	textQuery := `SELECT "secret", "enabled", "last_step" FROM user_totp WHERE "userID" = $1`
+	err := s.db.QueryRowContext(ctx, textQuery, userID).Scan(&out.Secret, &out.Enabled, &out.LastStep)
+
+	switch {
+	case err == sql.ErrNoRows:
+		return TOTP{}, nil
+	case err != nil:
+		return TOTP{}, err
+	default:
+		return out, nil
+	}
+}
+
+// SetTOTPSecret записывает новый неподтверждённый секрет. Включённый
+// второй фактор не трогается: возвращается ErrDuplicate.
+func (s *DB) SetTOTPSecret(ctx context.Context, userID string, secret string) error {
+
+	textInsert := `
+	INSERT INTO user_totp ("userID", "secret")
+	VALUES ($1, $2)
+	ON CONFLICT ("userID") DO UPDATE SET "secret" = $2, "last_step" = 0, "created_at" = now()
+	WHERE NOT user_totp."enabled"`
+	res, err := s.db.ExecContext(ctx, textInsert, userID, secret)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+// EnableTOTP включает второй фактор, принятый кодом шага step, и заменяет
+// коды восстановления. false — секрет уже включён или не выдан.
+func (s *DB) EnableTOTP(ctx context.Context, userID string, step int64, codeHashes []string) (bool, error) {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	textUpdate := `UPDATE user_totp SET "enabled" = true, "last_step" = $2, "enabled_at" = now()
+	WHERE "userID" = $1 AND NOT "enabled"`
+	res, err := tx.ExecContext(ctx, textUpdate, userID, step)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// UseTOTPStep запоминает принятый шаг; false — шаг не новее уже
+// принятого (повтор кода).
+func (s *DB) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+
+	textUpdate := `UPDATE user_totp SET "last_step" = $2 WHERE "userID" = $1 AND "enabled" AND "last_step" < $2`
+	res, err := s.db.ExecContext(ctx, textUpdate, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// UseRecoveryCode гасит код восстановления; false — нет такого
+// неиспользованного кода.
+func (s *DB) UseRecoveryCode(ctx context.Context, userID string, codeHash string) (bool, error) {
+
+	textUpdate := `UPDATE recovery_codes SET "used_at" = now()
+	WHERE "userID" = $1 AND "codeHash" = $2 AND "used_at" IS NULL`
+	res, err := s.db.ExecContext(ctx, textUpdate, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// ReplaceRecoveryCodes заменяет все коды восстановления пользователя.
+func (s *DB) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID string, codeHashes []string) error {
+
+	textDelete := `DELETE FROM recovery_codes WHERE "userID" = $1`
+	if _, err := tx.ExecContext(ctx, textDelete, userID); err != nil {
+		return err
+	}
+
+	textInsert := `INSERT INTO recovery_codes ("userID", "codeHash") VALUES ($1, $2)`
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, textInsert, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteTOTP выключает второй фактор и удаляет коды восстановления.
+func (s *DB) DeleteTOTP(ctx context.Context, userID string) error {
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	textDelete := `DELETE FROM recovery_codes WHERE "userID" = $1`
+	if _, err := tx.ExecContext(ctx, textDelete, userID); err != nil {
+		return err
+	}
+	textDelete = `DELETE FROM user_totp WHERE "userID" = $1`
+	if _, err := tx.ExecContext(ctx, textDelete, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,124 @@
+// Package validation — правила для логина и пароля при регистрации.
+package validation
+
+import (
+	"diplom_ya/internal/config"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rule — нарушенное правило.
+type Rule struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors — все нарушенные правила.
+type Errors []Rule
+
+func (e Errors) Error() string {
+	parts := make([]string, 0, len(e))
+	for _, item := range e {
+		parts = append(parts, item.Field+": "+item.Message)
+	}
+	return "validation: " + strings.Join(parts, "; ")
+}
+
+// NormalizeLogin приводит логин к виду, в котором он хранится: регистр
+// не различается, "Bob" и "bob" — один логин. Символы не проверяются,
+// чтобы входили и логины, заведённые до правил.
+func NormalizeLogin(login string) string {
+	return strings.ToLower(login)
+}
+
+// Register проверяет логин и пароль нового пользователя и возвращает
+// нормализованный логин; ошибка — Errors.
+func Register(cfg config.Config, login string, pass string) (string, error) {
+	login = NormalizeLogin(login)
+
+	var errs Errors
+	errs = append(errs, checkLogin(cfg, login)...)
+	errs = append(errs, checkPassword(cfg, "password", login, pass)...)
+	if len(errs) > 0 {
+		return login, errs
+	}
+	return login, nil
+}
+
+func checkLogin(cfg config.Config, login string) Errors {
+	const field = "login"
+
+	n := utf8.RuneCountInString(login)
+	switch {
+	case n == 0:
+		return Errors{{field, "required", "login is required"}}
+	case n < cfg.LoginMinLength:
+		return Errors{{field, "min_length", fmt.Sprintf("login must be at least %d characters", cfg.LoginMinLength)}}
+	case n > cfg.LoginMaxLength:
+		return Errors{{field, "max_length", fmt.Sprintf("login must be at most %d characters", cfg.LoginMaxLength)}}
+	}
+
+	for _, c := range login {
+		ok := c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.ContainsRune("._-@", c)
+		if !ok {
+			return Errors{{field, "charset", "login may contain only latin letters, digits and . _ - @"}}
+		}
+	}
+	return nil
+}
+
+// Password проверяет новый пароль пользователя login; field — имя поля
+// в ответе. Ошибка — Errors.
+func Password(cfg config.Config, field string, login string, pass string) error {
+	if errs := checkPassword(cfg, field, NormalizeLogin(login), pass); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func checkPassword(cfg config.Config, field string, login string, pass string) Errors {
+
+	n := utf8.RuneCountInString(pass)
+	switch {
+	case n == 0:
+		return Errors{{field, "required", "password is required"}}
+	case n < cfg.PasswordMinLength:
+		return Errors{{field, "min_length", fmt.Sprintf("password must be at least %d characters", cfg.PasswordMinLength)}}
+	case n > cfg.PasswordMaxLength:
+		return Errors{{field, "max_length", fmt.Sprintf("password must be at most %d characters", cfg.PasswordMaxLength)}}
+	}
+
+	var errs Errors
+	if classes(pass) < cfg.PasswordMinClasses {
+		errs = append(errs, Rule{field, "classes", fmt.Sprintf("password must mix at least %d of: lowercase, uppercase, digits, other characters", cfg.PasswordMinClasses)})
+	}
+	folded := strings.ToLower(pass)
+	if login != "" && strings.Contains(folded, login) {
+		errs = append(errs, Rule{field, "contains_login", "password must not contain the login"})
+	}
+	if cfg.PasswordDenyList[folded] {
+		errs = append(errs, Rule{field, "deny_list", "password is too common"})
+	}
+	return errs
+}
+
+// classes — сколько видов символов в пароле: строчные, заглавные, цифры, прочие.
+func classes(pass string) int {
+	var lower, upper, digit, other int
+	for _, c := range pass {
+		switch {
+		case unicode.IsLower(c):
+			lower = 1
+		case unicode.IsUpper(c):
+			upper = 1
+		case unicode.IsDigit(c):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
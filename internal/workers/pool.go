@@ -0,0 +1,189 @@
+package workers
+
+import (
+	"context"
+	"diplom_ya/internal/accrual"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/store"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	pollDelay     = time.Second            // повторный опрос, пока статус не окончательный
+	retryDelay    = time.Second            // первая задержка после ошибки, дальше растёт вдвое
+	maxRetryDelay = 5 * time.Minute        // предел задержки после ошибок
+	idleDelay     = 500 * time.Millisecond // пауза, когда в очереди нет готовых заказов
+	leaseTTL      = 2 * time.Minute        // на сколько заказ закрепляется за опросчиком
+)
+
+// Pool — пул опросчиков статусов заказов. Опросчики берут заказы из
+// очереди в хранилище, поэтому несколько реплик делят работу между собой,
+// а необработанные заказы переживают перезапуск. Все опросчики используют
+// один клиент системы расчёта, а значит, и общее окно ожидания после 429.
+// Ошибка или паника при обработке заказа не останавливает опросчик:
+// заказ откладывается, опросчик берёт следующий.
+type Pool struct {
+	cfg     config.Config
+	storage store.Storage
+	client  *accrual.Client
+	size    int
+	id      string
+
+	inFlight int64
+	wg       sync.WaitGroup
+}
+
+func NewPool(cfg config.Config, storage store.Storage, client *accrual.Client) *Pool {
+	size := cfg.AccrualWorkers
+	if size < 1 {
+		size = 1
+	}
+
+	host, _ := os.Hostname()
+	id := fmt.Sprintf("%s/%d/%s", host, os.Getpid(), uuid.New().String()[:8])
+
+	return &Pool{cfg: cfg, storage: storage, client: client, size: size, id: id}
+}
+
+// Start запускает опросчики; они работают, пока не отменён ctx.
+func (p *Pool) Start(ctx context.Context) {
+	for i := 0; i < p.size; i++ {
+		p.wg.Add(1)
+		go p.supervise(ctx, i)
+	}
+}
+
+// Wait дожидается завершения всех опросчиков.
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+// Shutdown дожидается завершения опросчиков, остановленных отменой
+// контекста Start, но не дольше, чем живёт ctx.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("workers: %d orders still in flight: %w", p.InFlight(), ctx.Err())
+	}
+}
+
+// Size — число опросчиков.
+func (p *Pool) Size() int {
+	return p.size
+}
+
+// InFlight — число заказов, обрабатываемых прямо сейчас.
+func (p *Pool) InFlight() int64 {
+	return atomic.LoadInt64(&p.inFlight)
+}
+
+// supervise перезапускает опросчик, если тот завершился раньше времени.
+func (p *Pool) supervise(ctx context.Context, id int) {
+	defer p.wg.Done()
+
+	workerID := fmt.Sprintf("%s/%d", p.id, id)
+	for {
+		if done := p.poll(ctx, workerID); done {
+			return
+		}
+		log.Printf("workers: poller %s restarted", workerID)
+	}
+}
+
+// poll берёт заказы из очереди; возвращает true, когда работа окончена.
+func (p *Pool) poll(ctx context.Context, workerID string) (done bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("workers: poller %s panic: %v\n%s", workerID, r, debug.Stack())
+		}
+	}()
+
+	for ctx.Err() == nil {
+		orders, err := p.storage.LeaseOrders(ctx, workerID, 1, leaseTTL)
+		if err != nil {
+			log.Printf("workers: lease orders: %v", err)
+		}
+		if len(orders) == 0 {
+			sleep(ctx, idleDelay)
+			continue
+		}
+		for _, item := range orders {
+			p.handle(ctx, workerID, item)
+		}
+	}
+	return true
+}
+
+func (p *Pool) handle(ctx context.Context, workerID string, item store.QueuedOrder) {
+	atomic.AddInt64(&p.inFlight, 1)
+	defer atomic.AddInt64(&p.inFlight, -1)
+
+	// отложить заказ нужно и при остановке, когда ctx уже отменён
+	ctxWrite := detach(ctx)
+
+	defer func() {
+		if r := recover(); r != nil {
+			p.reschedule(ctxWrite, workerID, item.Order, errorDelay(item.Attempts))
+			panic(fmt.Sprintf("order %s: %v", item.Order, r))
+		}
+	}()
+
+	status, err := processOrder(ctx, p.cfg, p.storage, p.client, item.Order)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// остановка: попытка не считается ошибкой, заказ вернётся в очередь сразу
+		p.reschedule(ctxWrite, workerID, item.Order, 0)
+	case err != nil:
+		log.Printf("workers: order %s (attempt %d): %v", item.Order, item.Attempts, err)
+		p.reschedule(ctxWrite, workerID, item.Order, errorDelay(item.Attempts))
+	case status == p.cfg.OrdersStatus.Processed || status == p.cfg.OrdersStatus.Invalid:
+		// окончательный статус, заказ уже удалён из очереди
+	default:
+		p.reschedule(ctxWrite, workerID, item.Order, pollDelay)
+	}
+}
+
+func (p *Pool) reschedule(ctx context.Context, workerID string, order string, delay time.Duration) {
+	if err := p.storage.RescheduleOrder(ctx, workerID, order, delay); err != nil {
+		// аренда истечёт сама, и заказ снова станет доступен
+		log.Printf("workers: reschedule order %s: %v", order, err)
+	}
+}
+
+// errorDelay — задержка перед попыткой attempts+1 после ошибки.
+func errorDelay(attempts int) time.Duration {
+	d := retryDelay
+	for i := 1; i < attempts && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
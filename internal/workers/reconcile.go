@@ -0,0 +1,41 @@
+package workers
+
+import (
+	"context"
+	"diplom_ya/internal/config"
+	"diplom_ya/internal/store"
+	"log"
+	"time"
+)
+
+// ReconcileLedger периодически сверяет кэшированные балансы с журналом
+// проводок и пишет в лог найденные расхождения.
+func ReconcileLedger(ctx context.Context, cfg config.Config, storage store.Storage) {
+	if cfg.ReconcileInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(cfg.ReconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		result, err := storage.Reconcile(ctx)
+		switch {
+		case err != nil:
+			log.Println("reconcile:", err)
+		case !result.OK():
+			for _, drift := range result.Drifts {
+				log.Printf("reconcile: user %s balance %s, ledger %s", drift.UserID, drift.Cached, drift.Ledger)
+			}
+			for _, entryID := range result.Unbalanced {
+				log.Printf("reconcile: entry %s is unbalanced", entryID)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -2,14 +2,24 @@ package workers
 
 import (
 	"context"
+	"diplom_ya/internal/accrual"
 	"diplom_ya/internal/config"
+	"diplom_ya/internal/store"
 )
 
-func CloseWorkers(cfg config.Config) {
-	close(cfg.ChanOrdersProc)
-}
+// StartWorkers запускает фоновую обработку; она останавливается отменой ctx,
+// дождаться её завершения можно через Pool.Shutdown.
+func StartWorkers(ctx context.Context, cfg config.Config, storage store.Storage) *Pool {
+	client := accrual.New(cfg, nil)
+	pool := NewPool(cfg, storage, client)
+
+	pool.Start(ctx)
+
+	pool.wg.Add(1)
+	go func() {
+		defer pool.wg.Done()
+		ReconcileLedger(ctx, cfg, storage)
+	}()
 
-func StartWorkers(cfg config.Config) {
-	go WriteOrderProcessing(context.Background(), cfg)
-	go ReadOrderProcessing(context.Background(), cfg)
+	return pool
 }